@@ -0,0 +1,986 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exit codes of the commands
+const (
+	// ExitOK is returned when everything asked for was done
+	ExitOK = 0
+	// ExitFailure is returned when an error stopped the command
+	ExitFailure = 1
+	// ExitUsage is returned for unknown commands, flags and option values
+	ExitUsage = 2
+	// ExitNothingToDo is returned when there were no files to group
+	ExitNothingToDo = 3
+	// ExitConflicts is returned when a preview found files whose
+	// destination is taken by another file, or when all the files were
+	// skipped and some of them because of that
+	ExitConflicts = 4
+	// ExitPartialFailure is returned when the command went through the
+	// files but some of them couldn't be grouped or undone
+	ExitPartialFailure = 5
+	// ExitInterrupted is returned when SIGINT or SIGTERM stopped the
+	// command before all the files were grouped
+	ExitInterrupted = 130
+)
+
+// command is a groupby subcommand such as group or undo
+type command struct {
+	name    string
+	args    string
+	summary string
+	// setup registers the flags of the command
+	setup func(flags *flag.FlagSet)
+	// run runs the command once its flags are parsed, returning the exit code
+	run func(flags *flag.FlagSet) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:    "group",
+			args:    "[OPTIONS]",
+			summary: "Group files into folders by date",
+			setup: func(flags *flag.FlagSet) {
+				addGroupingFlags(flags)
+				addVerboseFlags(flags)
+				addJobsFlag(flags)
+				addProgressFlags(flags)
+				addFailFastFlag(flags)
+				addVerifyFlags(flags)
+			},
+			run: runGroup,
+		},
+		{
+			name:    "preview",
+			args:    "[OPTIONS]",
+			summary: "Show how files would be grouped without touching them",
+			setup: func(flags *flag.FlagSet) {
+				addGroupingFlags(flags)
+				addFormatFlag(flags)
+			},
+			run: runPreview,
+		},
+		{
+			name:    "plan",
+			args:    "[OPTIONS] PLAN_FILE",
+			summary: "Write the operations grouping would perform to a plan file",
+			setup:   addGroupingFlags,
+			run:     runPlan,
+		},
+		{
+			name:    "apply",
+			args:    "[OPTIONS] PLAN_FILE",
+			summary: "Perform the operations of a plan file",
+			setup: func(flags *flag.FlagSet) {
+				flags.Bool("strict", false, "\tRefuse to apply the plan if the source of any operation changed since planning")
+				addVerboseFlags(flags)
+				addJobsFlag(flags)
+				addProgressFlags(flags)
+				addFailFastFlag(flags)
+				addVerifyFlags(flags)
+			},
+			run: runApply,
+		},
+		{
+			name:    "undo",
+			args:    "[OPTIONS] [OUTPUT_DIRECTORY]",
+			summary: "Undo the last run that grouped files into a directory",
+			setup: func(flags *flag.FlagSet) {
+				flags.String("journal", "", "\tJournal of the run to undo (default the latest in OUTPUT_DIRECTORY)")
+			},
+			run: runUndo,
+		},
+		{
+			name:    "resume",
+			args:    "[OPTIONS] [OUTPUT_DIRECTORY]",
+			summary: "Group the files an interrupted run left",
+			setup: func(flags *flag.FlagSet) {
+				flags.String("journal", "", "\tJournal of the run to resume (default the latest interrupted in OUTPUT_DIRECTORY)")
+				addVerboseFlags(flags)
+				addJobsFlag(flags)
+				addProgressFlags(flags)
+				addFailFastFlag(flags)
+				addVerifyFlags(flags)
+			},
+			run: runResume,
+		},
+		{
+			name:    "stats",
+			args:    "[OPTIONS]",
+			summary: "Show how many files and bytes would go into each folder",
+			setup:   addGroupingFlags,
+			run:     runStats,
+		},
+		{
+			name:    "regroup",
+			args:    "[OPTIONS]",
+			summary: "Move the files of a grouped directory into a different layout",
+			setup: func(flags *flag.FlagSet) {
+				addGroupingFlags(flags)
+				addVerboseFlags(flags)
+				addJobsFlag(flags)
+				addProgressFlags(flags)
+				addFailFastFlag(flags)
+				addVerifyFlags(flags)
+				flags.BoolVar(&dryRun, "preview", false, "\tOnly show how the files will be regrouped")
+			},
+			run: runRegroup,
+		},
+		{
+			name:    "ungroup",
+			args:    "[OPTIONS]",
+			summary: "Move the files of a grouped directory back out of their date folders",
+			setup: func(flags *flag.FlagSet) {
+				flags.StringVar(&directory, "d", "", "\tGrouped directory to ungroup")
+				flags.StringVar(&outputDirectory, "o", "", "\tDirectory to move the files to (default the -d directory)")
+				flags.StringVar(&conflictPolicy, "on-conflict", ConflictSkip, "\tWhat to do when a different file already exists at the destination: "+strings.Join(conflictPolicies, ", "))
+				flags.BoolVar(&includeHidden, "a", false, "\tInclude hidden files and directories (starting with .)")
+				flags.BoolVar(&dryRun, "preview", false, "\tOnly show how the files will be ungrouped")
+				addVerboseFlags(flags)
+				addJobsFlag(flags)
+				addProgressFlags(flags)
+				addFailFastFlag(flags)
+				addVerifyFlags(flags)
+			},
+			run: runUngroup,
+		},
+		{
+			name:    "verify",
+			args:    "[DIRECTORY]",
+			summary: "Check the files of a grouped directory against the " + manifestName + " manifests of its folders",
+			setup:   func(flags *flag.FlagSet) {},
+			run:     runVerify,
+		},
+		{
+			name:    "watch",
+			args:    "[OPTIONS]",
+			summary: "Group new files as they arrive in a directory",
+			setup: func(flags *flag.FlagSet) {
+				addGroupingFlags(flags)
+				addVerboseFlags(flags)
+				addJobsFlag(flags)
+				addProgressFlags(flags)
+				addFailFastFlag(flags)
+				addVerifyFlags(flags)
+				flags.DurationVar(&settleInterval, "settle", 5*time.Second, "\tTime a file's size and modification time must stay unchanged before it is grouped")
+				flags.DurationVar(&pollInterval, "poll", 2*time.Second, "\tInterval the directory is scanned at")
+				flags.BoolVar(&watchExisting, "existing", false, "\tAlso group the files already in the directory when watching starts")
+			},
+			run: runWatch,
+		},
+		{
+			name:    "presets",
+			args:    "[PRESET]",
+			summary: "List the built-in presets or show the options of one",
+			setup:   func(flags *flag.FlagSet) {},
+			run:     runPresets,
+		},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "groupby - Group files and directories by the date they were created or modified\n\n")
+	fmt.Fprintf(out, "Usage:\n  groupby COMMAND [OPTIONS]\n  groupby [OPTIONS]  (same as groupby group)\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nRun groupby help COMMAND for the options of a command.\n")
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command named by the first argument. Arguments starting with
+// a flag are the original command line without commands and run group.
+func run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return ExitUsage
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return runLegacy(args)
+	}
+
+	name := args[0]
+	if name == "help" {
+		if len(args) > 1 {
+			name, args = args[1], []string{args[1], "-h"}
+		} else {
+			usage()
+			return ExitOK
+		}
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %s\n\n", name)
+		usage()
+		return ExitUsage
+	}
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: groupby %s %s\n\n%s\n\nOptions:\n", cmd.name, cmd.args, cmd.summary)
+		flags.PrintDefaults()
+	}
+	cmd.setup(flags)
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if flags.Lookup("profile") != nil {
+		if err := applyConfig(flags); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return ExitUsage
+		}
+	}
+	return cmd.run(flags)
+}
+
+// runLegacy runs the flag only command line, where -dry-run, -preview and -p
+// preview and anything else groups
+func runLegacy(args []string) int {
+	flag.CommandLine.Parse(args)
+	if err := applyConfig(flag.CommandLine); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+
+	if showVersion {
+		fmt.Println("groupby ", version, " - Group files and directories by the date they were created or modified")
+		fmt.Println("By Zikani Nyirenda Mwase ")
+		return ExitOK
+	}
+
+	if _, err := os.Stat(directory); err != nil {
+		flag.PrintDefaults()
+		return ExitUsage
+	}
+
+	tree, err := buildTree()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return errorExitCode(err)
+	}
+	if outputFormat != "" {
+		return writePlanned(tree)
+	}
+	if dryRun {
+		printPreview(tree)
+		return previewExitCode(planOperations(tree))
+	}
+	return groupTree(tree)
+}
+
+// errorExitCode returns the exit code of a command stopped by err
+func errorExitCode(err error) int {
+	switch ErrorCode(err) {
+	case CodeInvalidOption, CodeInvalidPattern:
+		return ExitUsage
+	}
+	return ExitFailure
+}
+
+// previewExitCode returns the exit code of previewing the operations:
+// ExitConflicts if a destination is taken, ExitNothingToDo if there is no
+// file to group
+func previewExitCode(ops []*Operation) int {
+	code := ExitNothingToDo
+	for _, op := range ops {
+		if op.Conflict {
+			return ExitConflicts
+		}
+		if op.Action != ActionSkip {
+			code = ExitOK
+		}
+	}
+	return code
+}
+
+// checkDirectory returns an error if the -d directory is missing
+func checkDirectory(flags *flag.FlagSet) error {
+	if directory == "" {
+		flags.Usage()
+		return groupbyError("-d is required")
+	}
+	if _, err := os.Stat(directory); err != nil {
+		return err
+	}
+	return nil
+}
+
+// buildTree configures grouping from the parsed flags and builds the tree of
+// the files in the -d directory
+func buildTree() (*Tree, error) {
+	if err := configure(); err != nil {
+		return nil, invalidOption(err)
+	}
+	tree, err := NewTree(directory, depth)
+	if err != nil {
+		return nil, err
+	}
+	if !includeGrouped {
+		tree.SkipGrouped(outputDirectory)
+	}
+	if err := tree.Build(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// printPreview prints the tree followed by the trees of the files routed to
+// each rule
+func printPreview(tree *Tree) {
+	// Only the rules' trees are shown when every file was routed to a rule
+	routedOnly := len(tree.Routes) > 0 && !tree.Root.HasChildren()
+	if !routedOnly {
+		tree.Visit(NewPrintingVisitor())
+	}
+	directories, files := tree.Directories(), tree.Files()
+	for i, route := range tree.Routes {
+		if i > 0 || !routedOnly {
+			fmt.Println()
+		}
+		fmt.Printf("%s -> %s\n", route.Rule, route.Output())
+		route.Tree.Visit(NewPrintingVisitor())
+		directories += route.Tree.Directories()
+		files += route.Tree.Files()
+	}
+	fmt.Printf("\n%d directories, %d files\n", directories, files)
+	writeDuplicates(os.Stdout, tree)
+}
+
+// visitRoutes visits the trees of the routes, pointing the visitor's
+// destinations at the output directory and action of each rule
+func visitRoutes(tree *Tree, visitor NodeVisitor, destinations **destinationBuilder) {
+	for _, route := range tree.Routes {
+		*destinations = route.destinations(directory, flatten)
+		route.Tree.Visit(visitor)
+	}
+}
+
+// planOperations returns the operations grouping the tree would perform
+func planOperations(tree *Tree) []*Operation {
+	planVisitor := NewPlanVisitor(directory, outputDirectory, flatten)
+	tree.Visit(planVisitor)
+	visitRoutes(tree, planVisitor, &planVisitor.destinations)
+	// Duplicates are linked once their originals are grouped
+	return append(planVisitor.Operations, duplicateOperations(tree, planVisitor.Operations)...)
+}
+
+// writePlanned writes the operations grouping would perform in -format
+func writePlanned(tree *Tree) int {
+	ops := planOperations(tree)
+	if err := WriteOperations(os.Stdout, outputFormat, ops); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	return previewExitCode(ops)
+}
+
+// groupTree groups the files of the tree, recording what was done in a
+// journal in the output directory. The operations are planned first so the
+// progress knows how many there are.
+func groupTree(tree *Tree) int {
+	journal := NewJournal(outputDirectory)
+	defer journal.Close()
+	return executeTree(tree, journal)
+}
+
+// executeTree plans the operations grouping the tree and performs them on
+// -jobs workers, reporting the progress and a summary of the failures
+func executeTree(tree *Tree, journal *Journal) int {
+	if verbose {
+		tree.Visit(NewPrintingVisitor())
+	}
+	perm := os.FileMode(0755)
+	if stat, err := os.Stat(directory); err == nil {
+		perm = stat.Mode()
+	}
+
+	if duplicatePolicy == DuplicatesReport {
+		writeDuplicates(os.Stderr, tree)
+	}
+	ops := planOperations(tree)
+	return performOperations("group", NewExecutor(perm, journal), ops)
+}
+
+func runGroup(flags *flag.FlagSet) int {
+	if err := checkDirectory(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	tree, err := buildTree()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return errorExitCode(err)
+	}
+	return groupTree(tree)
+}
+
+func runPreview(flags *flag.FlagSet) int {
+	if err := checkDirectory(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	tree, err := buildTree()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return errorExitCode(err)
+	}
+	if outputFormat != "" {
+		return writePlanned(tree)
+	}
+	printPreview(tree)
+	return previewExitCode(planOperations(tree))
+}
+
+func runStats(flags *flag.FlagSet) int {
+	if err := checkDirectory(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	tree, err := buildTree()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return errorExitCode(err)
+	}
+	statsVisitor := NewStatsVisitor(directory, outputDirectory, flatten)
+	tree.Visit(statsVisitor)
+	visitRoutes(tree, statsVisitor, &statsVisitor.destinations)
+	statsVisitor.Write(os.Stdout)
+	return ExitOK
+}
+
+// runPlan builds the tree like grouping does and writes the operations that
+// would be performed to a plan file instead of performing them
+func runPlan(flags *flag.FlagSet) int {
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return ExitUsage
+	}
+	if err := checkDirectory(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	tree, err := buildTree()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return errorExitCode(err)
+	}
+
+	ops := planOperations(tree)
+	plan, err := NewPlanFile(directory, outputDirectory, ops)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+
+	out := os.Stdout
+	if filename := flags.Arg(0); filename != "-" {
+		if out, err = os.Create(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return ExitFailure
+		}
+		defer out.Close()
+	}
+	if err = WritePlanFile(out, plan); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	if out != os.Stdout {
+		fmt.Fprintf(os.Stderr, "Planned %d operations, run groupby apply %s to perform them\n", len(plan.Operations), flags.Arg(0))
+	}
+	// Conflicts are recorded in the plan, resolved with -on-conflict
+	return ExitOK
+}
+
+// runApply performs the operations of a plan file written by plan
+func runApply(flags *flag.FlagSet) int {
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	if err := validateExecutionFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+
+	in := os.Stdin
+	if filename := flags.Arg(0); filename != "-" {
+		var err error
+		if in, err = os.Open(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return ExitFailure
+		}
+		defer in.Close()
+	}
+	plan, err := ReadPlanFile(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+
+	if flags.Lookup("strict").Value.String() == "true" {
+		if changed := plan.Changed(); len(changed) > 0 {
+			for _, op := range changed {
+				fmt.Fprintf(os.Stderr, "Changed since planning: %s\n", op.Source)
+			}
+			fmt.Fprintf(os.Stderr, "Error: refusing to apply the plan, %d sources changed since planning\n", len(changed))
+			return ExitFailure
+		}
+	}
+
+	journal := NewJournal(plan.OutputDirectory())
+	defer journal.Close()
+	return applyPlan("apply the plan to", plan, journal)
+}
+
+// applyPlan performs the operations of the plan whose source didn't change
+// since planning, recording them in the journal
+func applyPlan(verb string, plan *PlanFile, journal *Journal) int {
+	planned, skipped := plan.Pending()
+	for _, op := range skipped {
+		fmt.Fprintf(os.Stderr, "Skipped %s, it changed since planning\n", op.Source)
+	}
+	ops := make([]*Operation, len(planned))
+	for i, op := range planned {
+		ops[i] = &op.Operation
+	}
+	return performOperations(verb, NewExecutor(plan.DirectoryMode, journal), ops)
+}
+
+// performOperations performs the operations with the executor and reports
+// the failures, verb saying what they do. SIGINT or SIGTERM stops it once
+// the operations in progress are done, saving the ones left next to the
+// journal so resume can perform them.
+func performOperations(verb string, executor *Executor, ops []*Operation) int {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-interrupt:
+			// Another interrupt stops groupby right away, even while
+			// watching
+			signal.Reset(os.Interrupt, syscall.SIGTERM)
+			fmt.Fprintf(os.Stderr, "\nInterrupted, finishing the files in progress\n")
+			executor.Stop()
+		case <-done:
+		}
+	}()
+	errs := executor.Execute(ops)
+	close(done)
+	signal.Stop(interrupt)
+
+	code := reportFailures(verb, ops, errs)
+	if err := UpdateManifests(ops, errs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		code = ExitFailure
+	}
+	var left []*Operation
+	for i, err := range errs {
+		if err == errInterrupted {
+			left = append(left, ops[i])
+		}
+	}
+	if len(left) == 0 {
+		return code
+	}
+	if err := executor.Journal.SavePending(left, executor.Perm); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save the %d files left: %s\n", len(left), err)
+		return ExitFailure
+	}
+	writeLeft(os.Stderr, left, pendingPath(executor.Journal.Path), executor.Journal.outputDir)
+	return ExitInterrupted
+}
+
+// maxListedLeft is the number of files left by an interrupted run listed
+// before the rest is only counted
+const maxListedLeft = 10
+
+// writeLeft writes the files an interrupted run left, saved in the pending
+// file, and how to resume grouping them into outputDir
+func writeLeft(w io.Writer, left []*Operation, pending, outputDir string) {
+	fmt.Fprintf(w, "Stopped with %d files left:\n", len(left))
+	for i, op := range left {
+		if i == maxListedLeft {
+			fmt.Fprintf(w, "  ... and %d more\n", len(left)-i)
+			break
+		}
+		fmt.Fprintf(w, "  %s -> %s\n", op.Source, op.Destination)
+	}
+	fmt.Fprintf(w, "They are saved in %s, run groupby resume %s to group them\n", pending, outputDir)
+}
+
+// runUndo reverses the operations recorded in a journal
+func runUndo(flags *flag.FlagSet) int {
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return ExitUsage
+	}
+	outputDir := "."
+	if flags.NArg() == 1 {
+		outputDir = flags.Arg(0)
+	}
+
+	filename := flags.Lookup("journal").Value.String()
+	if filename == "" {
+		var err error
+		if filename, err = LatestJournal(outputDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return ExitNothingToDo
+		}
+	}
+	entries, err := ReadJournal(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to read journal %s: %s\n", filename, err)
+		return ExitFailure
+	}
+
+	failed := Undo(entries, outputDir)
+	for _, entry := range entries {
+		if err, ok := failed[entry]; ok {
+			fmt.Fprintf(os.Stderr, "Failed to undo %s of %s: %s\n", entry.Action, entry.Destination, err)
+		}
+	}
+	if len(failed) > 0 {
+		return ExitPartialFailure
+	}
+	if err := MarkUndone(filename); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	fmt.Printf("Undid %d operations from %s\n", len(entries), filename)
+	return ExitOK
+}
+
+// runResume performs the operations an interrupted run left, recording them
+// in its journal so undo reverses the whole run
+func runResume(flags *flag.FlagSet) int {
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return ExitUsage
+	}
+	outputDir := "."
+	if flags.NArg() == 1 {
+		outputDir = flags.Arg(0)
+	}
+	if err := validateExecutionFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+
+	filename := flags.Lookup("journal").Value.String()
+	if filename == "" {
+		var err error
+		if filename, err = LatestPending(outputDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return ExitNothingToDo
+		}
+	}
+	in, err := os.Open(pendingPath(filename))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s was not interrupted: %s\n", filename, err)
+		return ExitNothingToDo
+	}
+	plan, err := ReadPlanFile(in)
+	in.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+
+	journal := OpenJournal(filename, plan.OutputDirectory())
+	defer journal.Close()
+	code := applyPlan("group", plan, journal)
+	// When interrupted again, the files still left were saved in its place
+	if code != ExitInterrupted {
+		if err := os.Remove(pendingPath(filename)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return ExitFailure
+		}
+	}
+	return code
+}
+
+// runPresets lists the presets, or prints the options a preset stands for
+// in the format of the configuration file
+func runPresets(flags *flag.FlagSet) int {
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return ExitUsage
+	}
+	if flags.NArg() == 0 {
+		for _, p := range presets {
+			fmt.Printf("  %-12s %s\n", p.Name, p.Description)
+		}
+		fmt.Printf("\nRun groupby presets PRESET for the options of a preset.\n")
+		return ExitOK
+	}
+
+	p := findPreset(flags.Arg(0))
+	if p == nil {
+		fmt.Fprintf(os.Stderr, "Error: unknown preset %s, expected one of %s\n", flags.Arg(0), strings.Join(PresetNames(), ", "))
+		return ExitUsage
+	}
+	fmt.Printf("# %s\n%s", p.Description, p.Config)
+	return ExitOK
+}
+
+// runWatch groups the files that arrive in the -d directory once they stop
+// changing, until interrupted. All the files grouped are recorded in one
+// journal, so undo reverses the whole session.
+func runWatch(flags *flag.FlagSet) int {
+	if err := checkDirectory(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	if err := configure(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	if err := validateExecutionFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	if pollInterval <= 0 || settleInterval < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -poll must be greater than zero and -settle can't be negative\n")
+		return ExitUsage
+	}
+
+	watcher, err := NewWatcher(directory, settleInterval, watchExisting)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	// Changes are noticed right away when the platform supports it,
+	// otherwise the directory is scanned every -poll interval
+	changes, err := watchDirectory(directory)
+	if err != nil && verbose {
+		fmt.Fprintf(os.Stderr, "Falling back to polling: %s\n", err)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	journal := NewJournal(outputDirectory)
+	defer journal.Close()
+	if verbose {
+		fmt.Printf("Watching %s\n", directory)
+	}
+	// The entries already there with -existing start settling right away
+	// rather than at the first change
+	if _, err := watcher.Scan(time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	code := ExitOK
+	for {
+		select {
+		case <-interrupt:
+			return code
+		case _, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+		case <-ticker.C:
+			// With change notifications, only entries waiting to settle
+			// need another look
+			if changes != nil && !watcher.Pending() {
+				continue
+			}
+		}
+
+		entries, err := watcher.Scan(time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return ExitFailure
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		// Interrupting a batch stops watching once the files in progress
+		// are done, saving the ones left for resume
+		switch batch := groupEntries(entries, watcher, journal); batch {
+		case ExitInterrupted:
+			return batch
+		case ExitFailure, ExitPartialFailure:
+			code = ExitPartialFailure
+		}
+	}
+}
+
+// groupEntries groups entries of the -d directory into the output directory,
+// telling the watcher to leave alone the folders they are grouped into. It
+// returns the exit code of grouping them.
+func groupEntries(entries []os.FileInfo, watcher *Watcher, journal *Journal) int {
+	tree, err := NewTree(directory, depth)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	if !includeGrouped {
+		tree.SkipGrouped(outputDirectory)
+	}
+	if err := tree.AddEntries(entries); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+
+	perm := os.FileMode(0755)
+	if stat, err := os.Stat(directory); err == nil {
+		perm = stat.Mode().Perm()
+	}
+	ops := planOperations(tree)
+	for _, op := range ops {
+		watcher.Ignore(op.Destination)
+	}
+	return performOperations("group", NewExecutor(perm, journal), ops)
+}
+
+// runRegroup moves the files of the date folders of the -d directory into
+// the layout given, removing the folders left empty
+func runRegroup(flags *flag.FlagSet) int {
+	if err := checkDirectory(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	if err := configure(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	if events || len(calendarEvents) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: regroup only supports the -year, -month and -day layouts\n")
+		return ExitUsage
+	}
+
+	tree, err := NewTree(directory, depth)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	folders, err := tree.Regroup()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	if dryRun {
+		printPreview(tree)
+		return previewExitCode(planOperations(tree))
+	}
+
+	code := groupTree(tree)
+	for _, folder := range folders {
+		removeEmptyDirs(folder, directory)
+	}
+	return code
+}
+
+// runUngroup moves the files of the date folders of the -d directory back
+// into one directory and removes the folders left empty
+func runUngroup(flags *flag.FlagSet) int {
+	if err := checkDirectory(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	if outputDirectory == "" {
+		outputDirectory = directory
+	}
+	if err := ValidateConflictPolicy(conflictPolicy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+	if err := validateExecutionFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitUsage
+	}
+
+	ops, folders, err := UngroupOperations(directory, outputDirectory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	if dryRun {
+		for _, op := range ops {
+			fmt.Printf("%s %s -> %s\n", op.Action, op.Source, op.Destination)
+		}
+		return previewExitCode(ops)
+	}
+
+	perm := os.FileMode(0755)
+	if stat, err := os.Stat(directory); err == nil {
+		perm = stat.Mode().Perm()
+	}
+	journal := NewJournal(outputDirectory)
+	defer journal.Close()
+	code := performOperations("ungroup", NewExecutor(perm, journal), ops)
+
+	for _, folder := range folders {
+		removeEmptyDirs(folder, directory)
+	}
+	return code
+}
+
+// runVerify checks the folders of a grouped directory that have a manifest
+// against it, listing the files missing, corrupted or not in it
+func runVerify(flags *flag.FlagSet) int {
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return ExitUsage
+	}
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+
+	report, err := VerifyManifests(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return ExitFailure
+	}
+	if report.Manifests == 0 {
+		fmt.Fprintf(os.Stderr, "No %s manifests found in %s\n", manifestName, dir)
+		return ExitNothingToDo
+	}
+	writeManifestReport(os.Stdout, report)
+	counts := map[string]int{}
+	for _, p := range report.Problems {
+		counts[p.Kind]++
+	}
+	fmt.Fprintf(os.Stderr, "Checked %d files in %d folders: %d missing, %d corrupted, %d extra\n",
+		report.Files, report.Manifests, counts[ManifestMissing], counts[ManifestCorrupted], counts[ManifestExtra])
+	if len(report.Problems) > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindCommand(t *testing.T) {
+	for _, name := range []string{"group", "preview", "plan", "apply", "undo", "stats"} {
+		if cmd := findCommand(name); cmd == nil || cmd.name != name {
+			t.Errorf("findCommand(\"%s\") did not find the command", name)
+		}
+	}
+	if findCommand("bogus") != nil {
+		t.Errorf("findCommand(\"bogus\") should not find a command")
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"bogus"}, 2},
+		{[]string{"plan", "-d", "."}, 2},
+		{[]string{"apply"}, 2},
+		{[]string{"group", "-no-such-flag"}, 2},
+		{[]string{}, 2},
+		{[]string{"presets", "bogus"}, 2},
+	}
+
+	for _, test := range tests {
+		if code := run(test.args); code != test.expected {
+			t.Errorf("run(%v) exit code is incorrect. Got '%d', Expected '%d'", test.args, code, test.expected)
+		}
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	empty := t.TempDir()
+	clean := t.TempDir()
+	conflicting := t.TempDir()
+	date := time.Date(2019, 7, 5, 12, 0, 0, 0, time.Local)
+	for _, dir := range []string{clean, conflicting} {
+		path := filepath.Join(dir, "a.txt")
+		os.WriteFile(path, []byte("a"), 0644)
+		os.Chtimes(path, date, date)
+	}
+	// A different file already takes the destination of a.txt
+	os.Mkdir(filepath.Join(conflicting, "2019"), 0755)
+	os.WriteFile(filepath.Join(conflicting, "2019", "a.txt"), []byte("other"), 0644)
+
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"preview", "-year", "-d", clean}, ExitOK},
+		{[]string{"preview", "-year", "-d", conflicting}, ExitConflicts},
+		{[]string{"preview", "-year", "-format", "json", "-d", conflicting}, ExitConflicts},
+		{[]string{"plan", "-year", "-d", conflicting, filepath.Join(t.TempDir(), "plan.json")}, ExitOK},
+		{[]string{"group", "-year", "-d", conflicting}, ExitConflicts},
+		{[]string{"preview", "-year", "-tz", "Nowhere/Bogus", "-d", clean}, ExitUsage},
+		{[]string{"preview", "-year", "-e", "(", "-d", clean}, ExitUsage},
+		{[]string{"group", "-year", "-d", empty}, ExitNothingToDo},
+		{[]string{"group", "-year", "-d", filepath.Join(empty, "missing")}, ExitUsage},
+		{[]string{"undo", empty}, ExitNothingToDo},
+		{[]string{"verify", empty}, ExitNothingToDo},
+		{[]string{"-d", filepath.Join(empty, "missing")}, ExitUsage},
+		{[]string{"-year", "-dry-run", "-d", clean}, ExitOK},
+	}
+
+	for _, test := range tests {
+		if code := run(test.args); code != test.expected {
+			t.Errorf("run(%v) exit code is incorrect. Got '%d', Expected '%d'", test.args, code, test.expected)
+		}
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	dir := t.TempDir()
+	var ops []*Operation
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+		ops = append(ops, &Operation{Source: filepath.Join(dir, name), Destination: filepath.Join(dir, "2019", name), Action: ActionMove})
+	}
+	journal := NewJournal(dir)
+	journal.SavePending(ops, 0755)
+	journal.Close()
+
+	if code := run([]string{"resume", dir}); code != ExitOK {
+		t.Fatalf("run(resume) exit code is incorrect. Got '%d', Expected '%d'", code, ExitOK)
+	}
+	for _, op := range ops {
+		if _, err := os.Stat(op.Destination); err != nil {
+			t.Errorf("resume did not move %s: %s", op.Source, err)
+		}
+	}
+	if entries, err := ReadJournal(journal.Path); err != nil || len(entries) != 2 {
+		t.Errorf("resume should record in the interrupted run's journal. Got %d entries (%v), Expected 2", len(entries), err)
+	}
+	if code := run([]string{"resume", dir}); code != ExitNothingToDo {
+		t.Errorf("run(resume) after resuming exit code is incorrect. Got '%d', Expected '%d'", code, ExitNothingToDo)
+	}
+}
+
+func TestRunGroupFailures(t *testing.T) {
+	tests := []struct {
+		failFast bool
+		// moved is whether b.jpg is grouped after a.jpg failed
+		moved bool
+	}{
+		{false, true},
+		{true, false},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		for i, name := range []string{"a.jpg", "b.jpg"} {
+			path := filepath.Join(dir, name)
+			os.WriteFile(path, []byte(name), 0644)
+			date := time.Date(2019+i, 7, 5, 12, 0, 0, 0, time.Local)
+			os.Chtimes(path, date, date)
+		}
+		// 2019 is a file, so a.jpg can't be grouped into it
+		out := t.TempDir()
+		os.WriteFile(filepath.Join(out, "2019"), nil, 0644)
+
+		args := []string{"group", "-year", "-jobs", "1", "-d", dir, "-o", out}
+		if test.failFast {
+			args = append(args, "-fail-fast")
+		}
+		if code := run(args); code != ExitPartialFailure {
+			t.Errorf("run(%v) exit code is incorrect. Got '%d', Expected '%d'", args, code, ExitPartialFailure)
+		}
+		if _, err := os.Stat(filepath.Join(out, "2020", "b.jpg")); (err == nil) != test.moved {
+			t.Errorf("run(%v) grouping b.jpg is incorrect. Got %v, Expected moved=%t", args, err, test.moved)
+		}
+	}
+}
+
+func TestWriteLeft(t *testing.T) {
+	var left []*Operation
+	for i := 0; i < maxListedLeft+2; i++ {
+		left = append(left, &Operation{Source: fmt.Sprintf("%02d.jpg", i), Destination: fmt.Sprintf("2019/%02d.jpg", i)})
+	}
+	var buf bytes.Buffer
+	writeLeft(&buf, left, "run.pending.json", "photos")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		"Stopped with 12 files left:",
+		"  00.jpg -> 2019/00.jpg",
+		"  ... and 2 more",
+		"They are saved in run.pending.json, run groupby resume photos to group them",
+	}
+	if len(lines) != maxListedLeft+3 {
+		t.Fatalf("writeLeft wrote %d lines, Expected %d:\n%s", len(lines), maxListedLeft+3, buf.String())
+	}
+	for i, got := range []string{lines[0], lines[1], lines[len(lines)-2], lines[len(lines)-1]} {
+		if got != expected[i] {
+			t.Errorf("writeLeft is incorrect. Got '%s', Expected '%s'", got, expected[i])
+		}
+	}
+}
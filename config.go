@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configTable is a table of a configuration file. Values are strings, int64,
+// bool, []interface{} or nested configTables. Arrays of tables ([[name]]) are
+// []configTable.
+type configTable map[string]interface{}
+
+// configAliases are the names configuration keys may use instead of the
+// names of the flags they set
+var configAliases = map[string]string{
+	"source":   "d",
+	"output":   "o",
+	"filter":   "pattern",
+	"conflict": "on-conflict",
+	"verbose":  "v",
+	"hidden":   "a",
+}
+
+// configLayouts are the values of the layout key and the flag each one sets
+var configLayouts = map[string]string{
+	"year":   "year",
+	"month":  "month",
+	"day":    "day",
+	"events": "events",
+}
+
+// ConfigFiles returns the configuration files read when -config isn't
+// given, in the order they are applied: the user's configuration
+// (~/.config/groupby/config on Linux) and .groupby in the current directory
+func ConfigFiles() []string {
+	var files []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "groupby", "config"))
+	}
+	return append(files, ".groupby")
+}
+
+// LoadConfig reads and merges the configuration files, later files taking
+// precedence. Files that don't exist are skipped unless required.
+func LoadConfig(filenames []string, required bool) (configTable, error) {
+	config := configTable{}
+	for _, filename := range filenames {
+		file, err := os.Open(filename)
+		if os.IsNotExist(err) && !required {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		table, err := ParseConfig(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		mergeConfig(config, table)
+	}
+	return config, nil
+}
+
+// mergeConfig merges src into dst, values of src taking precedence
+func mergeConfig(dst, src configTable) {
+	for key, value := range src {
+		if table, ok := value.(configTable); ok {
+			if existing, ok := dst[key].(configTable); ok {
+				mergeConfig(existing, table)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// Profile returns the table of the named profile
+func (c configTable) Profile(name string) (configTable, error) {
+	profiles, _ := c["profiles"].(configTable)
+	profile, ok := profiles[name].(configTable)
+	if !ok {
+		return nil, groupbyError("Unknown profile '" + name + "'")
+	}
+	return profile, nil
+}
+
+// ProfileNames returns the names of the profiles in sorted order
+func (c configTable) ProfileNames() []string {
+	profiles, _ := c["profiles"].(configTable)
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyTo sets the flags named by the keys of the table, leaving alone the
+// flags given on the command line and nested tables
+func (c configTable) ApplyTo(flags *flag.FlagSet, given map[string]bool) error {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := c[key]
+		switch value.(type) {
+		case configTable, []configTable:
+			continue
+		}
+
+		name, ok := configAliases[key]
+		if !ok {
+			name = key
+		}
+		str, err := configString(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if key == "layout" {
+			if name, ok = configLayouts[str]; !ok {
+				return groupbyError("Unknown layout '" + str + "', expected year, month, day or events")
+			}
+			if err := setLayout(flags, given, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "d" || name == "o" {
+			str = expandHome(str)
+		}
+
+		if flags.Lookup(name) == nil {
+			if knownOption(name) {
+				// An option of another command, e.g. verbose when previewing
+				continue
+			}
+			return groupbyError("Unknown option '" + key + "'")
+		}
+		if given[name] {
+			continue
+		}
+		if err := flags.Set(name, str); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setLayout sets the flag of the layout and clears the others, unless a
+// layout was given on the command line
+func setLayout(flags *flag.FlagSet, given map[string]bool, layout string) error {
+	for _, name := range configLayouts {
+		if given[name] {
+			return nil
+		}
+	}
+	for _, name := range configLayouts {
+		if flags.Lookup(name) == nil {
+			continue
+		}
+		if err := flags.Set(name, strconv.FormatBool(name == layout)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// knownOption returns true if name is an option of any command
+func knownOption(name string) bool {
+	all := flag.NewFlagSet("all", flag.ContinueOnError)
+	addGroupingFlags(all)
+	addFormatFlag(all)
+	addVerboseFlags(all)
+	addJobsFlag(all)
+	addProgressFlags(all)
+	addFailFastFlag(all)
+	addVerifyFlags(all)
+	return all.Lookup(name) != nil
+}
+
+// configString returns the value as it would be given on the command line,
+// with arrays joined by commas
+func configString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, err := configString(item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, ","), nil
+	}
+	return "", groupbyError("Unsupported value")
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// addConfigFlags registers the flags choosing the configuration
+func addConfigFlags(flags *flag.FlagSet) {
+	flags.String("config", "", "\tConfiguration file to read instead of ~/.config/groupby/config and ./.groupby")
+	flags.String("profile", "", "\tName of the configuration profile to use")
+	flags.String("preset", "", "\tBuilt-in preset to use: "+strings.Join(PresetNames(), ", ")+" (see groupby presets)")
+}
+
+// givenFlags returns the names of the flags given on the command line, along
+// with the ones setting the same variable as one given, such as -pattern
+// when -e was given
+func givenFlags(flags *flag.FlagSet) map[string]bool {
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		flags.VisitAll(func(other *flag.Flag) {
+			if sameVariable(f.Value, other.Value) {
+				given[other.Name] = true
+			}
+		})
+	})
+	return given
+}
+
+// sameVariable returns true if both flag values set the same variable
+func sameVariable(a, b flag.Value) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	return va.Kind() == reflect.Ptr && va.Type() == vb.Type() && va.Pointer() == vb.Pointer()
+}
+
+// applyConfig applies the -preset, the configuration files and the -profile
+// chosen to the parsed flags. Each overrides the fields of the ones before,
+// and flags given on the command line take precedence over all of them.
+func applyConfig(flags *flag.FlagSet) error {
+	given := givenFlags(flags)
+
+	filenames, required := ConfigFiles(), false
+	if configFile := flags.Lookup("config").Value.String(); configFile != "" {
+		filenames, required = []string{configFile}, true
+	}
+	config, err := LoadConfig(filenames, required)
+	if err != nil {
+		return err
+	}
+
+	var profile configTable
+	profileName := flags.Lookup("profile").Value.String()
+	if profileName != "" {
+		if profile, err = config.Profile(profileName); err != nil {
+			return err
+		}
+	}
+
+	// The preset may also be chosen by the profile or the configuration
+	presetName := flags.Lookup("preset").Value.String()
+	for _, table := range []configTable{profile, config} {
+		if name, ok := table["preset"].(string); ok && presetName == "" {
+			presetName = name
+		}
+	}
+	var presetTable configTable
+	if presetName != "" {
+		if presetTable, err = Preset(presetName, config); err != nil {
+			return err
+		}
+	}
+
+	layers := []struct {
+		name  string
+		table configTable
+	}{
+		{"preset " + presetName, presetTable},
+		{"", config},
+		{"profile " + profileName, profile},
+	}
+	var ruleTables []configTable
+	for _, layer := range layers {
+		if layer.table == nil {
+			continue
+		}
+		if err := layer.table.ApplyTo(flags, given); err != nil {
+			if layer.name != "" {
+				return fmt.Errorf("%s: %w", layer.name, err)
+			}
+			return err
+		}
+		// Rules are replaced as a whole
+		if tables, ok := layer.table["rules"].([]configTable); ok {
+			ruleTables = tables
+		}
+	}
+
+	rules, err = ParseRules(ruleTables)
+	return err
+}
+
+// ParseConfig parses a configuration file written in a subset of TOML: tables,
+// arrays of tables, strings, integers, booleans and arrays
+func ParseConfig(r io.Reader) (configTable, error) {
+	root := configTable{}
+	current := root
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripConfigComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		lineError := func(msg string) error {
+			return groupbyError("line " + strconv.Itoa(lineNo) + ": " + msg)
+		}
+
+		if strings.HasPrefix(line, "[[") {
+			if !strings.HasSuffix(line, "]]") {
+				return nil, lineError("expected ]]")
+			}
+			parent, key, err := configParent(root, line[2:len(line)-2])
+			if err != nil {
+				return nil, lineError(err.Error())
+			}
+			tables, _ := parent[key].([]configTable)
+			if _, exists := parent[key]; exists && tables == nil {
+				return nil, lineError(key + " is not an array of tables")
+			}
+			current = configTable{}
+			parent[key] = append(tables, current)
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, lineError("expected ]")
+			}
+			parent, key, err := configParent(root, line[1:len(line)-1])
+			if err != nil {
+				return nil, lineError(err.Error())
+			}
+			table, ok := parent[key].(configTable)
+			if !ok {
+				if _, exists := parent[key]; exists {
+					return nil, lineError(key + " is already defined")
+				}
+				table = configTable{}
+				parent[key] = table
+			}
+			current = table
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, lineError("expected key = value")
+		}
+		key := unquoteConfigKey(strings.TrimSpace(line[:eq]))
+		raw := strings.TrimSpace(line[eq+1:])
+		// Arrays may span several lines
+		for strings.HasPrefix(raw, "[") && !configBracketsClosed(raw) && scanner.Scan() {
+			lineNo++
+			raw += " " + strings.TrimSpace(stripConfigComment(scanner.Text()))
+		}
+		value, rest, err := parseConfigValue(raw)
+		if err != nil {
+			return nil, lineError(err.Error())
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, lineError("unexpected " + rest)
+		}
+		if _, exists := current[key]; exists {
+			return nil, lineError(key + " is already defined")
+		}
+		current[key] = value
+	}
+	return root, scanner.Err()
+}
+
+// configParent returns the table holding the last part of a dotted table
+// name, creating the tables leading to it, along with that last part
+func configParent(root configTable, name string) (configTable, string, error) {
+	parts := splitConfigKey(name)
+	table := root
+	for _, part := range parts[:len(parts)-1] {
+		switch next := table[part].(type) {
+		case configTable:
+			table = next
+		case []configTable:
+			// [[rules]] followed by [rules.match] refers to the last rule
+			table = next[len(next)-1]
+		case nil:
+			created := configTable{}
+			table[part] = created
+			table = created
+		default:
+			return nil, "", groupbyError(part + " is not a table")
+		}
+	}
+	return table, parts[len(parts)-1], nil
+}
+
+// splitConfigKey splits a dotted key, keeping dots inside quotes
+func splitConfigKey(name string) []string {
+	var parts []string
+	var current strings.Builder
+	quote := rune(0)
+	for _, r := range name {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '.':
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return append(parts, strings.TrimSpace(current.String()))
+}
+
+func unquoteConfigKey(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
+
+// stripConfigComment removes a # comment that isn't inside a string
+func stripConfigComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// configBracketsClosed returns true if every [ outside of strings is closed
+func configBracketsClosed(s string) bool {
+	depth := 0
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '[':
+			depth++
+		case quote == 0 && c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// parseConfigValue parses the value at the start of s, returning the rest
+func parseConfigValue(s string) (interface{}, string, error) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" {
+		return nil, "", groupbyError("missing value")
+	}
+
+	switch s[0] {
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '"':
+				return b.String(), s[i+1:], nil
+			case '\\':
+				if i+1 >= len(s) {
+					return nil, "", groupbyError("unterminated string")
+				}
+				i++
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\':
+					b.WriteByte(s[i])
+				default:
+					return nil, "", groupbyError("invalid escape \\" + string(s[i]) + ", use single quotes for regular expressions")
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return nil, "", groupbyError("unterminated string")
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", groupbyError("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case '[':
+		var items []interface{}
+		rest := strings.TrimLeft(s[1:], " \t")
+		for {
+			if strings.HasPrefix(rest, "]") {
+				return items, rest[1:], nil
+			}
+			item, r, err := parseConfigValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, item)
+			rest = strings.TrimLeft(r, " \t")
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " \t")
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", groupbyError("expected , or ] in array")
+			}
+		}
+	}
+
+	end := strings.IndexAny(s, ",] \t")
+	if end < 0 {
+		end = len(s)
+	}
+	word, rest := s[:end], s[end:]
+	switch word {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 10, 64)
+	if err != nil {
+		return nil, "", groupbyError("invalid value " + word)
+	}
+	return n, rest, nil
+}
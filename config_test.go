@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+# Defaults for every run
+month-format = "01"
+
+[profiles.photos]
+source = "~/Pictures/inbox"
+output = '/srv/photos'   # literal string
+layout = "day"
+filter = '\.jpe?g$'
+conflict = "rename"
+date-source = ["exif", "modified"]
+
+[profiles."phone dump"]
+layout = "events"
+event-gap = "2h"
+`
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("ParseConfig returned an error: %s", err)
+	}
+
+	if config["month-format"] != "01" {
+		t.Errorf("Top-level month-format is incorrect. Got '%v', Expected '01'", config["month-format"])
+	}
+	photos, err := config.Profile("photos")
+	if err != nil {
+		t.Fatalf("Profile(\"photos\") returned an error: %s", err)
+	}
+	if photos["output"] != "/srv/photos" || photos["filter"] != `\.jpe?g$` {
+		t.Errorf("Profile photos is incorrect. Got %v", photos)
+	}
+	if sources, ok := photos["date-source"].([]interface{}); !ok || len(sources) != 2 {
+		t.Errorf("Profile photos date-source is incorrect. Got %v", photos["date-source"])
+	}
+	if names := config.ProfileNames(); len(names) != 2 || names[0] != "phone dump" {
+		t.Errorf("ProfileNames() is incorrect. Got %v", names)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []string{
+		"key",
+		"key = \"unterminated",
+		"key = 1\nkey = 2",
+		"[table",
+		"key = [1, 2",
+		`pattern = "\.jpg"`,
+	}
+
+	for _, test := range tests {
+		if _, err := ParseConfig(strings.NewReader(test)); err == nil {
+			t.Errorf("ParseConfig(%q) should fail", test)
+		}
+	}
+}
+
+func TestConfigApplyTo(t *testing.T) {
+	defer func() {
+		flags := flag.NewFlagSet("reset", flag.ContinueOnError)
+		addGroupingFlags(flags)
+	}()
+
+	config, err := ParseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, _ := config.Profile("photos")
+
+	flags := flag.NewFlagSet("group", flag.ContinueOnError)
+	addGroupingFlags(flags)
+	addVerboseFlags(flags)
+	if err := flags.Parse([]string{"-o", "/tmp/out"}); err != nil {
+		t.Fatal(err)
+	}
+	given := map[string]bool{"o": true}
+	if err := profile.ApplyTo(flags, given); err != nil {
+		t.Fatalf("ApplyTo returned an error: %s", err)
+	}
+
+	if outputDirectory != "/tmp/out" {
+		t.Errorf("ApplyTo should not override flags given on the command line. Got '%s'", outputDirectory)
+	}
+	if !day || conflictPolicy != ConflictRename || dateSource != "exif,modified" || filterPattern != `\.jpe?g$` {
+		t.Errorf("ApplyTo did not set the profile's flags. Got day=%t on-conflict=%s date-source=%s pattern=%s",
+			day, conflictPolicy, dateSource, filterPattern)
+	}
+	if strings.HasPrefix(directory, "~") {
+		t.Errorf("ApplyTo did not expand ~ in the source. Got '%s'", directory)
+	}
+
+	unknown := configTable{"colour": "blue"}
+	if err := unknown.ApplyTo(flags, given); err == nil {
+		t.Errorf("ApplyTo should fail for an unknown option")
+	}
+}
+
+func TestGivenFlagsAliases(t *testing.T) {
+	defer func() {
+		flags := flag.NewFlagSet("reset", flag.ContinueOnError)
+		addGroupingFlags(flags)
+		addVerboseFlags(flags)
+	}()
+
+	flags := flag.NewFlagSet("preview", flag.ContinueOnError)
+	addGroupingFlags(flags)
+	addVerboseFlags(flags)
+	if err := flags.Parse([]string{"-e", "jpg$", "-v"}); err != nil {
+		t.Fatal(err)
+	}
+	given := givenFlags(flags)
+	for _, name := range []string{"e", "pattern", "v", "verbose"} {
+		if !given[name] {
+			t.Errorf("givenFlags should include -%s", name)
+		}
+	}
+	if given["o"] {
+		t.Errorf("givenFlags should not include -o, which wasn't given")
+	}
+
+	config := configTable{"filter": "txt$", "verbose": false}
+	if err := config.ApplyTo(flags, given); err != nil {
+		t.Fatalf("ApplyTo returned an error: %s", err)
+	}
+	if filterPattern != "jpg$" || !verbose {
+		t.Errorf("ApplyTo should not override the short aliases given. Got pattern=%s verbose=%t", filterPattern, verbose)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Hash algorithms -verify checks copies with
+const (
+	HashSHA256 = "sha256"
+	// HashFast is CRC-64, much faster than SHA-256 and enough to notice
+	// corruption, though not tampering
+	HashFast = "fast"
+)
+
+var hashAlgorithms = []string{HashSHA256, HashFast}
+
+// ValidateHashAlgorithm returns an error if name isn't one of the hash
+// algorithms
+func ValidateHashAlgorithm(name string) error {
+	for _, h := range hashAlgorithms {
+		if name == h {
+			return nil
+		}
+	}
+	return groupbyError("Unknown hash '" + name + "', expected one of " + strings.Join(hashAlgorithms, ", "))
+}
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// newHash returns a hash of the algorithm and the prefix of its checksums
+func newHash(algorithm string) (hash.Hash, string) {
+	if algorithm == HashFast {
+		return crc64.New(crc64Table), "crc64:"
+	}
+	return sha256.New(), "sha256:"
+}
+
+// HashFile returns the checksum of the file with the algorithm, e.g.
+// sha256:9f86d0...
+func HashFile(path, algorithm string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h, prefix := newHash(algorithm)
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isCrossDevice returns true if err is the error of renaming or linking
+// across file systems
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// copyFile copies the regular file at src to dst, keeping its permissions
+// and modification time. The copy is written next to dst and renamed into
+// place once complete, replacing dst if overwrite is set. With a hash
+// algorithm, the copy is read back and its checksum compared with the one of
+// the source, which is returned.
+func copyFile(src, dst string, overwrite bool, algorithm string) (string, error) {
+	stat, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	if !stat.Mode().IsRegular() {
+		return "", codedError(CodeCrossDevice, src, &os.LinkError{Op: "copy", Old: src, New: dst, Err: syscall.EXDEV})
+	}
+	if !overwrite {
+		if _, err := os.Lstat(dst); err == nil {
+			return "", codedError(CodeDestinationConflict, dst, &os.PathError{Op: "copy", Path: dst, Err: os.ErrExist})
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".groupby-copy")
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, stat.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	var reader io.Reader = in
+	var h hash.Hash
+	var prefix string
+	if algorithm != "" {
+		h, prefix = newHash(algorithm)
+		reader = io.TeeReader(in, h)
+	}
+	_, err = io.Copy(out, reader)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chtimes(tmp, stat.ModTime(), stat.ModTime()); err != nil {
+		return "", err
+	}
+
+	var checksum string
+	if algorithm != "" {
+		checksum = prefix + hex.EncodeToString(h.Sum(nil))
+		copied, err := HashFile(tmp, algorithm)
+		if err != nil {
+			return "", err
+		}
+		if copied != checksum {
+			return "", &GroupbyError{Code: CodeChecksumMismatch, Path: dst,
+				Message: "The copy of " + src + " doesn't match it, " + copied + " instead of " + checksum}
+		}
+	}
+	return checksum, os.Rename(tmp, dst)
+}
+
+// moveFile renames src to dst, copying it and removing it when they are on
+// different file systems. Unless overwrite is set, an existing dst is a
+// conflict rather than replaced. The source is only removed once the copy is
+// complete and, with a hash algorithm, matches it. It returns the checksum of
+// the copy, if there was one.
+func moveFile(src, dst string, overwrite bool, algorithm string) (string, error) {
+	if !overwrite {
+		if _, err := os.Lstat(dst); err == nil {
+			return "", codedError(CodeDestinationConflict, dst, &os.PathError{Op: "move", Path: dst, Err: os.ErrExist})
+		}
+	}
+	err := os.Rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return "", err
+	}
+	checksum, err := copyFile(src, dst, overwrite, algorithm)
+	if err != nil {
+		return "", err
+	}
+	return checksum, os.Remove(src)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.txt")
+	os.WriteFile(path, []byte("hello"), 0644)
+
+	tests := []struct {
+		algorithm string
+		expected  string
+	}{
+		{HashSHA256, "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{HashFast, fmt.Sprintf("crc64:%016x", crc64.Checksum([]byte("hello"), crc64Table))},
+	}
+
+	for _, test := range tests {
+		if got, err := HashFile(path, test.algorithm); err != nil || got != test.expected {
+			t.Errorf("HashFile(%s) is incorrect. Got '%s' (%v), Expected '%s'", test.algorithm, got, err, test.expected)
+		}
+	}
+}
+
+func TestValidateHashAlgorithm(t *testing.T) {
+	for _, algorithm := range hashAlgorithms {
+		if err := ValidateHashAlgorithm(algorithm); err != nil {
+			t.Errorf("ValidateHashAlgorithm(%s) is incorrect. Got '%s', Expected nil", algorithm, err)
+		}
+	}
+	if err := ValidateHashAlgorithm("md5"); err == nil {
+		t.Errorf("ValidateHashAlgorithm(md5) should return an error")
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.jpg")
+	os.WriteFile(src, []byte("photo"), 0640)
+	modTime := time.Date(2019, 7, 5, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(src, modTime, modTime)
+	dst := filepath.Join(dir, "copy.jpg")
+
+	checksum, err := copyFile(src, dst, false, HashSHA256)
+	if err != nil {
+		t.Fatalf("copyFile returned an error: %s", err)
+	}
+	if expected, _ := HashFile(src, HashSHA256); checksum != expected {
+		t.Errorf("copyFile checksum is incorrect. Got '%s', Expected '%s'", checksum, expected)
+	}
+	stat, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(dst); string(content) != "photo" {
+		t.Errorf("copyFile content is incorrect. Got '%s', Expected 'photo'", content)
+	}
+	if !stat.ModTime().Equal(modTime) || stat.Mode().Perm() != 0640 {
+		t.Errorf("copyFile should keep the modification time and permissions. Got %s %s", stat.ModTime(), stat.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("copyFile left %d files in the directory, Expected 2", len(entries))
+	}
+
+	if _, err := copyFile(src, dst, false, ""); !errors.Is(err, ErrDestinationConflict) {
+		t.Errorf("copyFile to an existing file should fail with a destination conflict. Got %v", err)
+	}
+	if checksum, err := copyFile(src, dst, true, ""); err != nil || checksum != "" {
+		t.Errorf("copyFile with overwrite is incorrect. Got '%s' (%v), Expected no checksum", checksum, err)
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.jpg")
+	os.WriteFile(src, []byte("photo"), 0644)
+	dst := filepath.Join(dir, "b.jpg")
+
+	// Files on the same file system are renamed, there is nothing to verify
+	if checksum, err := moveFile(src, dst, false, HashSHA256); err != nil || checksum != "" {
+		t.Errorf("moveFile is incorrect. Got '%s' (%v), Expected no checksum", checksum, err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("moveFile should remove the source")
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Errorf("moveFile did not move the file: %s", err)
+	}
+}
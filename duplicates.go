@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Policies for files with the same content as another file being grouped
+const (
+	DuplicatesNone = "none"
+	// DuplicatesReport groups duplicates like the other files and lists them
+	DuplicatesReport = "report"
+	// DuplicatesSkip leaves duplicates where they are
+	DuplicatesSkip = "skip"
+	// DuplicatesMove moves duplicates into the _duplicates folder
+	DuplicatesMove = "move"
+	// DuplicatesLink replaces duplicates with hard links to their original,
+	// next to it
+	DuplicatesLink = "link"
+)
+
+var duplicatePolicies = []string{DuplicatesNone, DuplicatesReport, DuplicatesSkip, DuplicatesMove, DuplicatesLink}
+
+// duplicatesDirName is the folder of the output directory duplicates are
+// moved into with -duplicates move
+const duplicatesDirName = "_duplicates"
+
+// ValidateDuplicatePolicy returns an error if policy is not one of the
+// duplicate policies
+func ValidateDuplicatePolicy(policy string) error {
+	for _, p := range duplicatePolicies {
+		if policy == p {
+			return nil
+		}
+	}
+	return groupbyError("Unknown duplicates policy '" + policy + "', expected one of " + strings.Join(duplicatePolicies, ", "))
+}
+
+// Duplicate is a file with the same content as another file of the same
+// directory, its original
+type Duplicate struct {
+	Name     string
+	Original string
+}
+
+// FindDuplicates returns the regular files of dir with the same content as
+// another one. Only files of the same size are hashed. The file modified
+// first of each set of identical files, or with the shortest name, is their
+// original. Empty files and files that can't be read are never duplicates.
+func FindDuplicates(dir string, files []os.FileInfo) []*Duplicate {
+	bySize := map[int64][]os.FileInfo{}
+	for _, f := range files {
+		if !f.Mode().IsRegular() || f.Size() == 0 || strings.HasPrefix(f.Name(), ".") && !includeHidden {
+			continue
+		}
+		bySize[f.Size()] = append(bySize[f.Size()], f)
+	}
+
+	var duplicates []*Duplicate
+	for _, sameSize := range bySize {
+		if len(sameSize) < 2 {
+			continue
+		}
+		sort.Slice(sameSize, func(i, j int) bool {
+			if !sameSize[i].ModTime().Equal(sameSize[j].ModTime()) {
+				return sameSize[i].ModTime().Before(sameSize[j].ModTime())
+			}
+			// Copies usually have longer names, such as "IMG_0042 (1).jpg"
+			if len(sameSize[i].Name()) != len(sameSize[j].Name()) {
+				return len(sameSize[i].Name()) < len(sameSize[j].Name())
+			}
+			return sameSize[i].Name() < sameSize[j].Name()
+		})
+		originals := map[string]string{}
+		for _, f := range sameSize {
+			sum, err := HashFile(filepath.Join(dir, f.Name()), HashSHA256)
+			if err != nil {
+				if verbose {
+					fmt.Fprintf(os.Stderr, "Not checking %s for duplicates: %s\n", f.Name(), err)
+				}
+				continue
+			}
+			if original, ok := originals[sum]; ok {
+				duplicates = append(duplicates, &Duplicate{Name: f.Name(), Original: original})
+			} else {
+				originals[sum] = f.Name()
+			}
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Name < duplicates[j].Name
+	})
+	return duplicates
+}
+
+// separateDuplicates finds the duplicates among the entries according to
+// -duplicates, returning the entries to group: all of them when duplicates
+// are only reported, the others otherwise. Duplicates are added to the
+// _duplicates folder with -duplicates move.
+func (t *Tree) separateDuplicates(entries []os.FileInfo) []os.FileInfo {
+	// Files with companions aren't interchangeable, their sidecars may differ
+	var candidates []os.FileInfo
+	for _, f := range entries {
+		if len(t.sidecars[f.Name()]) == 0 {
+			candidates = append(candidates, f)
+		}
+	}
+	duplicates := FindDuplicates(t.Root.FileName, candidates)
+	if len(duplicates) == 0 {
+		return entries
+	}
+	t.Duplicates = append(t.Duplicates, duplicates...)
+	if t.duplicateOf == nil {
+		t.duplicateOf = map[string]string{}
+	}
+	for _, d := range duplicates {
+		t.duplicateOf[d.Name] = d.Original
+	}
+	if duplicatePolicy == DuplicatesReport {
+		return entries
+	}
+
+	unique := make([]os.FileInfo, 0, len(entries))
+	for _, f := range entries {
+		if _, ok := t.duplicateOf[f.Name()]; !ok {
+			unique = append(unique, f)
+			continue
+		}
+		if duplicatePolicy == DuplicatesMove && t.count(f) {
+			folder := t.Root.Search(duplicatesDirName)
+			if folder == nil {
+				folder = NewNode(duplicatesDirName, t.Root.Year, t.Root.Month, t.Root.Day)
+				t.Root.AddChild(folder)
+			}
+			folder.AddChild(t.newFileNode(f))
+		}
+	}
+	return unique
+}
+
+// duplicateOperations returns the operations of the duplicates left out of
+// the tree by -duplicates skip or link, given the operations of the tree.
+// Skipped duplicates stay where they are. Linked duplicates are hard linked
+// to the destination of their original under their own name, and removed
+// unless grouping with -copy-only. The destination of the original doesn't
+// exist until it is grouped, so the links are fingerprinted by the original.
+// Duplicates whose original isn't grouped are skipped.
+func duplicateOperations(tree *Tree, ops []*Operation) []*Operation {
+	if duplicatePolicy != DuplicatesSkip && duplicatePolicy != DuplicatesLink {
+		return nil
+	}
+	b := newDestinationBuilder(directory, outputDirectory, flatten)
+	bySource := map[string]*Operation{}
+	for _, op := range ops {
+		b.planned[op.Destination] = true
+		bySource[op.Source] = op
+	}
+
+	var dupOps []*Operation
+	for _, d := range tree.Duplicates {
+		source, original := path.Join(directory, d.Name), path.Join(directory, d.Original)
+		op := bySource[original]
+		if duplicatePolicy == DuplicatesSkip || op == nil || op.Action == ActionSkip && op.Conflict {
+			dupOps = append(dupOps, &Operation{Source: source, Destination: source, Action: ActionSkip, DuplicateOf: original})
+			continue
+		}
+
+		link := &Operation{
+			Source:      op.Destination,
+			Destination: path.Join(path.Dir(op.Destination), d.Name),
+			Date:        op.Date,
+			DateSource:  op.DateSource,
+			Action:      ActionLink,
+			DuplicateOf: original,
+		}
+		b.resolveConflict(link)
+		dupOps = append(dupOps, link)
+		if link.Action != ActionSkip && !copyOnly {
+			unlink := *link
+			unlink.Source, unlink.Action = source, ActionUnlink
+			dupOps = append(dupOps, &unlink)
+		}
+	}
+	return dupOps
+}
+
+// writeDuplicates writes the duplicates of the tree and their originals
+func writeDuplicates(w io.Writer, tree *Tree) {
+	if len(tree.Duplicates) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%d duplicates (%s):\n", len(tree.Duplicates), duplicatePolicy)
+	for _, d := range tree.Duplicates {
+		fmt.Fprintf(w, "  %s, duplicate of %s\n", d.Name, d.Original)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeDuplicatesDir writes photo.jpg, a copy of it modified later, a file
+// of the same size with other content, an empty file and a hidden copy
+func writeDuplicatesDir(t *testing.T) string {
+	dir := t.TempDir()
+	first := time.Date(2019, 7, 5, 12, 0, 0, 0, time.Local)
+	files := []struct {
+		name    string
+		content string
+		date    time.Time
+	}{
+		{"photo.jpg", "photo", first},
+		{"b copy.jpg", "photo", first.AddDate(0, 1, 0)},
+		{"other.jpg", "other", first},
+		{"empty.jpg", "", first},
+		{".hidden.jpg", "photo", first},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, f.date, f.date)
+	}
+	os.WriteFile(filepath.Join(dir, "empty copy.jpg"), nil, 0644)
+	return dir
+}
+
+func TestFindDuplicates(t *testing.T) {
+	dir := writeDuplicatesDir(t)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []os.FileInfo
+	for _, entry := range entries {
+		info, _ := entry.Info()
+		files = append(files, info)
+	}
+
+	expected := []*Duplicate{{Name: "b copy.jpg", Original: "photo.jpg"}}
+	if got := FindDuplicates(dir, files); !reflect.DeepEqual(got, expected) {
+		t.Errorf("FindDuplicates is incorrect. Got %v, Expected %v", got, expected)
+	}
+}
+
+func TestValidateDuplicatePolicy(t *testing.T) {
+	for _, policy := range duplicatePolicies {
+		if err := ValidateDuplicatePolicy(policy); err != nil {
+			t.Errorf("ValidateDuplicatePolicy(%s) is incorrect. Got '%s', Expected nil", policy, err)
+		}
+	}
+	if err := ValidateDuplicatePolicy("delete"); err == nil {
+		t.Errorf("ValidateDuplicatePolicy(delete) should return an error")
+	}
+}
+
+func TestDuplicatePolicies(t *testing.T) {
+	defer func(d, o, p string) { directory, outputDirectory, duplicatePolicy = d, o, p }(directory, outputDirectory, duplicatePolicy)
+
+	tests := []struct {
+		policy string
+		// expected maps the names of the files to the action taken on them
+		// and where they end up, relative to the output directory
+		expected map[string]string
+	}{
+		{DuplicatesNone, map[string]string{"b copy.jpg": "move 2019/b copy.jpg"}},
+		{DuplicatesReport, map[string]string{"b copy.jpg": "move 2019/b copy.jpg"}},
+		{DuplicatesSkip, map[string]string{"b copy.jpg": "skip b copy.jpg"}},
+		{DuplicatesMove, map[string]string{"b copy.jpg": "move _duplicates/b copy.jpg"}},
+		{DuplicatesLink, map[string]string{
+			filepath.Join("2019", "photo.jpg"): "link 2019/b copy.jpg",
+			"b copy.jpg":                       "unlink 2019/b copy.jpg",
+		}},
+	}
+
+	for _, test := range tests {
+		dir := writeDuplicatesDir(t)
+		directory, outputDirectory, duplicatePolicy = dir, dir, test.policy
+		tree, err := NewTree(dir, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Build(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := map[string]string{}
+		for _, op := range planOperations(tree) {
+			if op.Action == ActionMove && filepath.Base(op.Source) != "b copy.jpg" {
+				continue
+			}
+			source, _ := filepath.Rel(dir, op.Source)
+			dest, _ := filepath.Rel(dir, op.Destination)
+			got[source] = op.Action + " " + filepath.ToSlash(dest)
+			if test.policy != DuplicatesNone && op.DuplicateOf != filepath.Join(dir, "photo.jpg") {
+				t.Errorf("DuplicateOf of %s with -duplicates %s is incorrect. Got '%s', Expected photo.jpg", source, test.policy, op.DuplicateOf)
+			}
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Operations with -duplicates %s are incorrect. Got %v, Expected %v", test.policy, got, test.expected)
+		}
+	}
+}
+
+func TestDuplicateLinks(t *testing.T) {
+	defer func(d, o, p string) { directory, outputDirectory, duplicatePolicy = d, o, p }(directory, outputDirectory, duplicatePolicy)
+	dir := writeDuplicatesDir(t)
+	directory, outputDirectory, duplicatePolicy = dir, dir, DuplicatesLink
+	tree, err := NewTree(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The links are planned before the originals they link to are grouped
+	plan, err := NewPlanFile(dir, dir, planOperations(tree))
+	if err != nil {
+		t.Fatalf("NewPlanFile returned an error: %s", err)
+	}
+	planned, skipped := plan.Pending()
+	if len(skipped) != 0 {
+		t.Errorf("PlanFile.Pending() skipped %d operations, Expected 0", len(skipped))
+	}
+	ops := make([]*Operation, len(planned))
+	for i, op := range planned {
+		ops[i] = &op.Operation
+	}
+	journal := NewJournal(dir)
+	for i, err := range NewExecutor(0755, journal).Execute(ops) {
+		if err != nil {
+			t.Fatalf("Executing %s returned an error: %s", ops[i].Source, err)
+		}
+	}
+	journal.Close()
+
+	original, duplicate := filepath.Join(dir, "2019", "photo.jpg"), filepath.Join(dir, "2019", "b copy.jpg")
+	a, errA := os.Stat(original)
+	b, errB := os.Stat(duplicate)
+	if errA != nil || errB != nil || !os.SameFile(a, b) {
+		t.Fatalf("b copy.jpg is not a link to photo.jpg: %v, %v", errA, errB)
+	}
+
+	entries, err := ReadJournal(journal.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed := Undo(entries, dir); len(failed) != 0 {
+		t.Fatalf("Undo failed for %d entries", len(failed))
+	}
+	a, errA = os.Stat(filepath.Join(dir, "photo.jpg"))
+	b, errB = os.Stat(filepath.Join(dir, "b copy.jpg"))
+	if errA != nil || errB != nil || os.SameFile(a, b) {
+		t.Errorf("Undo did not give b copy.jpg its own file back: %v, %v", errA, errB)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "b copy.jpg")); string(content) != "photo" {
+		t.Errorf("Content of b copy.jpg is incorrect. Got '%s', Expected 'photo'", content)
+	}
+}
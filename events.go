@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// EventName returns the folder name of an event starting at start, with the
+// optional label appended to it
+func EventName(start time.Time, label string) string {
+	name := start.Format("2006-01-02 15.04")
+	if label != "" {
+		name += " " + label
+	}
+	return name
+}
+
+// AddEvents groups the files into events directly below the root of the tree.
+//
+// Files are sorted by time and a new event is started whenever the time
+// between two consecutive files is greater than gap, so an event may span
+// midnight and two shoots on the same day end up in different folders.
+func (t *Tree) AddEvents(files []os.FileInfo, gap time.Duration) {
+	nodes := make([]*Node, 0, len(files))
+	for _, f := range files {
+		if t.count(f) {
+			nodes = append(nodes, t.newFileNode(f))
+		}
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Date.Before(nodes[j].Date)
+	})
+
+	var eventNode *Node
+	var previous time.Time
+	for _, node := range nodes {
+		if eventNode == nil || node.Date.Sub(previous) > gap {
+			name := EventName(node.Date.In(location), eventLabel)
+			eventNode = t.Root.Search(name)
+			if eventNode == nil {
+				eventNode = NewNode(name, node.Year, node.Month, node.Day)
+				t.Root.AddChild(eventNode)
+			}
+		}
+		eventNode.AddChild(node)
+		previous = node.Date
+	}
+}
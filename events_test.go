@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEventName(t *testing.T) {
+	start := time.Date(2019, time.June, 1, 18, 30, 0, 0, time.UTC)
+	tests := []struct {
+		label    string
+		expected string
+	}{
+		{"", "2019-06-01 18.30"},
+		{"Wedding", "2019-06-01 18.30 Wedding"},
+	}
+
+	for _, test := range tests {
+		if name := EventName(start, test.label); name != test.expected {
+			t.Errorf("EventName with label '%s' is incorrect. Got '%s', Expected '%s'", test.label, name, test.expected)
+		}
+	}
+}
+
+func TestAddEventsSplitsOnGaps(t *testing.T) {
+	base := time.Date(2019, time.June, 1, 22, 0, 0, 0, time.UTC)
+	fileMode := os.FileMode(0644)
+	files := []os.FileInfo{
+		fileInfo{"late.jpg", 1024, fileMode, base.Add(3 * time.Hour)},
+		fileInfo{"first.jpg", 1024, fileMode, base},
+		fileInfo{"midnight.jpg", 1024, fileMode, base.Add(2 * time.Hour)},
+		fileInfo{"next-day.jpg", 1024, fileMode, base.Add(12 * time.Hour)},
+		fileInfo{".hidden.jpg", 1024, fileMode, base.Add(30 * time.Hour)},
+	}
+
+	tree := &Tree{
+		Root:     NewNode("/", base.Year(), base.Month(), base.Day()),
+		MaxDepth: 1,
+	}
+	includeHidden = false
+	eventLabel = ""
+	tree.AddEvents(files, 3*time.Hour)
+
+	tests := []struct {
+		event string
+		files []string
+	}{
+		{"2019-06-01 22.00", []string{"first.jpg", "midnight.jpg", "late.jpg"}},
+		{"2019-06-02 10.00", []string{"next-day.jpg"}},
+	}
+
+	for _, test := range tests {
+		eventNode := tree.Root.Search(test.event)
+		if eventNode == nil {
+			t.Errorf("Event '%s' expected, but not found.", test.event)
+			continue
+		}
+		for _, f := range test.files {
+			if eventNode.Search(f) == nil {
+				t.Errorf("File '%s' expected in event '%s', but not found.", f, test.event)
+			}
+		}
+	}
+
+	if tree.Files() != 4 {
+		t.Errorf("Tree's Files() is incorrect. Got '%d', Expected '%d'", tree.Files(), 4)
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// dirCreator creates each destination directory once, however many workers
+// need it at the same time
+type dirCreator struct {
+	mu   sync.Mutex
+	dirs map[string]*dirCreation
+}
+
+type dirCreation struct {
+	once sync.Once
+	err  error
+}
+
+func (c *dirCreator) create(dir string, perm os.FileMode) error {
+	c.mu.Lock()
+	d, ok := c.dirs[dir]
+	if !ok {
+		d = &dirCreation{}
+		c.dirs[dir] = d
+	}
+	c.mu.Unlock()
+
+	d.once.Do(func() {
+		d.err = os.MkdirAll(dir, perm)
+	})
+	return d.err
+}
+
+// performWith creates the destination directory of the operation with the
+// creator, performs it and records it in the journal. Errors get the code of
+// their cause.
+func performWith(op *Operation, creator *dirCreator, perm os.FileMode, journal *Journal) error {
+	if err := performCreating(op, creator, perm); err != nil {
+		return err
+	}
+	return journal.Record(op)
+}
+
+// performCreating creates the destination directory of the operation with
+// the creator and performs it
+func performCreating(op *Operation, creator *dirCreator, perm os.FileMode) error {
+	if op.Action != ActionUnlink {
+		if err := creator.create(filepath.Dir(op.Destination), perm); err != nil {
+			return operationError(op, err)
+		}
+	}
+	if err := performOperation(op); err != nil {
+		return operationError(op, err)
+	}
+	return nil
+}
+
+// performUnit performs the operation of a file and the ones of its
+// companions as a unit: when one fails, the ones performed before it are
+// reverted and the others not performed, all of them failing. They are
+// recorded in the journal once all of them succeeded.
+func performUnit(unit []*Operation, creator *dirCreator, perm os.FileMode, journal *Journal) []error {
+	errs := make([]error, len(unit))
+	for i, op := range unit {
+		err := performCreating(op, creator, perm)
+		if err == nil {
+			continue
+		}
+		errs[i] = err
+		for j, other := range unit {
+			if j == i || other.Action == ActionSkip {
+				continue
+			}
+			errs[j] = &GroupbyError{Message: "not grouped, " + op.Source + " failed", Err: err}
+			if j > i {
+				continue
+			}
+			// A file that can't be put back stays grouped, and undo can
+			// put it back later
+			if revertErr := revertOperation(other); revertErr != nil {
+				errs[j] = &GroupbyError{Message: "grouped, but not put back after " + op.Source + " failed", Err: revertErr}
+				journal.Record(other)
+			}
+		}
+		return errs
+	}
+	for i, op := range unit {
+		errs[i] = journal.Record(op)
+	}
+	return errs
+}
+
+// revertOperation puts the file of a performed operation back, or removes
+// the link it made
+func revertOperation(op *Operation) error {
+	switch op.Action {
+	case ActionMove:
+		_, err := moveFile(op.Destination, op.Source, false, "")
+		return err
+	case ActionLink, ActionSymlink:
+		return os.Remove(op.Destination)
+	}
+	return nil
+}
+
+// operationUnits returns the units of the operations of files with
+// companions, by the index of the file's operation: its index followed by the
+// ones of the operations of its companions. Companions whose file has no
+// operation are on their own.
+func operationUnits(ops []*Operation) map[int][]int {
+	units := map[int][]int{}
+	bySource := map[string]int{}
+	for i, op := range ops {
+		if op.Primary == "" {
+			bySource[op.Source] = i
+			continue
+		}
+		if p, ok := bySource[op.Primary]; ok {
+			if units[p] == nil {
+				units[p] = []int{p}
+			}
+			units[p] = append(units[p], i)
+		}
+	}
+	return units
+}
+
+// operationChains splits the operations into chains of the indexes of the
+// operations sharing a source or destination path, in the order given.
+// Companions are in the chain of their file. Operations of different chains
+// never touch the same path.
+func operationChains(ops []*Operation) [][]int {
+	// Union-find over the operations, joined by the paths they touch
+	parent := make([]int, len(ops))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	byPath := map[string]int{}
+	for i, op := range ops {
+		for _, path := range []string{op.Source, op.Destination, op.Primary} {
+			if path == "" {
+				continue
+			}
+			path = filepath.Clean(path)
+			if j, ok := byPath[path]; ok {
+				parent[find(i)] = find(j)
+			} else {
+				byPath[path] = i
+			}
+		}
+	}
+
+	var chains [][]int
+	chainOf := map[int]int{}
+	for i := range ops {
+		root := find(i)
+		c, ok := chainOf[root]
+		if !ok {
+			c = len(chains)
+			chainOf[root] = c
+			chains = append(chains, nil)
+		}
+		chains[c] = append(chains[c], i)
+	}
+	return chains
+}
+
+// errNotPerformed is the error of the operations that weren't performed
+// because an earlier one failed with -fail-fast
+var errNotPerformed = groupbyError("not performed after an earlier failure")
+
+// errInterrupted is the error of the operations that weren't performed
+// because the executor was stopped
+var errInterrupted = groupbyError("not performed, interrupted")
+
+// Executor performs operations, creating their destination directories with
+// Perm, recording the ones performed in the Journal and reporting each one
+// done to the Progress
+type Executor struct {
+	Perm     os.FileMode
+	Jobs     int
+	FailFast bool
+	Journal  *Journal
+	Progress *Progress
+
+	failed  int32
+	stopped int32
+}
+
+// NewExecutor returns an executor creating directories with perm and
+// recording operations in journal, using -jobs, -fail-fast and -progress
+func NewExecutor(perm os.FileMode, journal *Journal) *Executor {
+	return &Executor{
+		Perm:     perm,
+		Jobs:     jobs,
+		FailFast: failFast,
+		Journal:  journal,
+		Progress: NewProgress(os.Stderr, progressMode, progressInterval),
+	}
+}
+
+// Stop stops the executor: the operations in progress are finished and the
+// ones not started yet fail with errInterrupted
+func (e *Executor) Stop() {
+	atomic.StoreInt32(&e.stopped, 1)
+}
+
+// Execute performs the operations on Jobs workers. Operations sharing a
+// source or destination path are performed one after another in the order
+// given, and files with companions along with them as a unit. A failed
+// operation doesn't stop the others unless FailFast is set, in which case
+// the ones not started yet fail with errNotPerformed. It returns the error of
+// each operation by index, nil for the ones that succeeded or were skipped.
+func (e *Executor) Execute(ops []*Operation) []error {
+	errs := make([]error, len(ops))
+	creator := &dirCreator{dirs: map[string]*dirCreation{}}
+	units := operationUnits(ops)
+	companions := map[int]bool{}
+	for _, unit := range units {
+		for _, i := range unit[1:] {
+			companions[i] = true
+		}
+	}
+	perform := func(i int) {
+		// Companions are performed with their file
+		if companions[i] {
+			return
+		}
+		unit := units[i]
+		if unit == nil {
+			unit = []int{i}
+		}
+		var todo []int
+		for _, j := range unit {
+			if ops[j].Action != ActionSkip {
+				todo = append(todo, j)
+			}
+		}
+		if len(todo) == 0 {
+			return
+		}
+		var notPerformed error
+		switch {
+		case atomic.LoadInt32(&e.stopped) != 0:
+			notPerformed = errInterrupted
+		case e.FailFast && atomic.LoadInt32(&e.failed) != 0:
+			notPerformed = errNotPerformed
+		}
+		if notPerformed != nil {
+			for _, j := range todo {
+				errs[j] = notPerformed
+			}
+			return
+		}
+		sizes := map[int]int64{}
+		if e.Progress != nil {
+			for _, j := range todo {
+				sizes[j] = operationSize(ops[j])
+			}
+		}
+		if len(unit) == 1 {
+			errs[i] = performWith(ops[i], creator, e.Perm, e.Journal)
+		} else {
+			unitOps := make([]*Operation, len(unit))
+			for k, j := range unit {
+				unitOps[k] = ops[j]
+			}
+			for k, err := range performUnit(unitOps, creator, e.Perm, e.Journal) {
+				errs[unit[k]] = err
+			}
+		}
+		for _, j := range todo {
+			if errs[j] != nil {
+				atomic.StoreInt32(&e.failed, 1)
+			}
+			e.Progress.Done(ops[j], sizes[j], errs[j])
+		}
+	}
+
+	e.Progress.Start(ops)
+	defer e.Progress.Finish()
+	if e.Jobs <= 1 {
+		for i := range ops {
+			perform(i)
+		}
+		return errs
+	}
+
+	chains := make(chan []int)
+	var wg sync.WaitGroup
+	for w := 0; w < e.Jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chain := range chains {
+				for _, i := range chain {
+					perform(i)
+				}
+			}
+		}()
+	}
+	for _, chain := range operationChains(ops) {
+		chains <- chain
+	}
+	close(chains)
+	wg.Wait()
+	return errs
+}
+
+// reportFailures prints a summary of the operations that failed and of the
+// files skipped because their destination is taken, verb saying what they
+// were doing, and returns the exit code of the run: ExitPartialFailure if
+// any failed, ExitConflicts if all of them were skipped and some because of
+// a conflict and ExitNothingToDo if all of them were skipped otherwise.
+// Operations interrupted aren't failures.
+func reportFailures(verb string, ops []*Operation, errs []error) int {
+	var failed, conflicts []int
+	notPerformed, skipped := 0, 0
+	for i, err := range errs {
+		switch {
+		case err == errInterrupted:
+		case err == errNotPerformed:
+			notPerformed++
+		case err != nil:
+			failed = append(failed, i)
+		case ops[i].Action == ActionSkip:
+			skipped++
+			if ops[i].Conflict {
+				conflicts = append(conflicts, i)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "\nSkipped %d files whose destination is taken by a different file:\n", len(conflicts))
+		for _, i := range conflicts {
+			fmt.Fprintf(os.Stderr, "  %s -> %s\n", ops[i].Source, ops[i].Destination)
+		}
+	}
+	if len(failed) == 0 {
+		switch {
+		case skipped < len(ops):
+			return ExitOK
+		case len(conflicts) > 0:
+			return ExitConflicts
+		}
+		return ExitNothingToDo
+	}
+
+	fmt.Fprintf(os.Stderr, "\nFailed to %s %d of %d files:\n", verb, len(failed), len(ops))
+	for _, i := range failed {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", ops[i].Source, errs[i])
+	}
+	if notPerformed > 0 {
+		fmt.Fprintf(os.Stderr, "Stopped at the first failure, files left alone: %d\n", notPerformed)
+	}
+	return ExitPartialFailure
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOperationChains(t *testing.T) {
+	ops := []*Operation{
+		{Source: "a", Destination: "out/a"},
+		{Source: "b", Destination: "out/b"},
+		{Source: "out/a", Destination: "out/c"},
+		{Source: "d", Destination: "out/b"},
+		{Source: "e", Destination: "out/e"},
+	}
+	expected := [][]int{{0, 2}, {1, 3}, {4}}
+
+	if got := operationChains(ops); !reflect.DeepEqual(got, expected) {
+		t.Errorf("operationChains is incorrect. Got %v, Expected %v", got, expected)
+	}
+}
+
+func TestExecutor(t *testing.T) {
+	for _, jobs := range []int{1, 8} {
+		dir := t.TempDir()
+		var ops []*Operation
+		for i := 0; i < 50; i++ {
+			source := filepath.Join(dir, fmt.Sprintf("%02d.jpg", i))
+			if err := os.WriteFile(source, []byte(source), 0644); err != nil {
+				t.Fatal(err)
+			}
+			ops = append(ops, &Operation{
+				Source:      source,
+				Destination: filepath.Join(dir, "out", fmt.Sprint(i%5), filepath.Base(source)),
+				Action:      ActionMove,
+			})
+		}
+		// Operations on the same destination are performed in order
+		last := filepath.Join(dir, "last.jpg")
+		os.WriteFile(last, []byte("last"), 0644)
+		ops = append(ops,
+			&Operation{Source: filepath.Join(dir, "missing.jpg"), Destination: filepath.Join(dir, "out", "same.jpg"), Action: ActionMove},
+			&Operation{Source: last, Destination: filepath.Join(dir, "out", "same.jpg"), Action: ActionLink, Overwrite: true},
+		)
+
+		journal := NewJournal(dir)
+		executor := &Executor{Perm: 0755, Jobs: jobs, Journal: journal}
+		errs := executor.Execute(ops)
+		journal.Close()
+
+		for i, err := range errs {
+			if (err != nil) != (i == 50) {
+				t.Errorf("Execute with %d jobs error of operation %d is incorrect: %v", jobs, i, err)
+			}
+		}
+		if content, err := os.ReadFile(filepath.Join(dir, "out", "same.jpg")); err != nil || string(content) != "last" {
+			t.Errorf("Execute with %d jobs should perform operations on the same path in order. Got '%s' (%v)", jobs, content, err)
+		}
+		entries, err := ReadJournal(journal.Path)
+		if err != nil || len(entries) != 51 {
+			t.Errorf("Execute with %d jobs recorded %d operations (%v), Expected 51", jobs, len(entries), err)
+		}
+	}
+}
+
+func TestExecutorFailFast(t *testing.T) {
+	for _, test := range []struct {
+		failFast bool
+		expected []error
+	}{
+		{failFast: false, expected: []error{nil, nil, nil}},
+		{failFast: true, expected: []error{errNotPerformed, errNotPerformed, errNotPerformed}},
+	} {
+		dir := t.TempDir()
+		ops := []*Operation{{Source: filepath.Join(dir, "missing.jpg"), Destination: filepath.Join(dir, "out", "missing.jpg"), Action: ActionMove}}
+		for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+			source := filepath.Join(dir, name)
+			os.WriteFile(source, []byte(name), 0644)
+			ops = append(ops, &Operation{Source: source, Destination: filepath.Join(dir, "out", name), Action: ActionMove})
+		}
+
+		executor := &Executor{Perm: 0755, Jobs: 1, FailFast: test.failFast}
+		errs := executor.Execute(ops)
+		if errs[0] == nil {
+			t.Errorf("Execute with -fail-fast=%t should fail to move a missing file", test.failFast)
+		}
+		if !reflect.DeepEqual(errs[1:], test.expected) {
+			t.Errorf("Execute with -fail-fast=%t is incorrect. Got %v, Expected %v", test.failFast, errs[1:], test.expected)
+		}
+	}
+}
+
+func TestReportFailures(t *testing.T) {
+	ops := []*Operation{{Source: "a.jpg"}, {Source: "b.jpg"}}
+	if code := reportFailures("group", ops, []error{nil, nil}); code != 0 {
+		t.Errorf("reportFailures without failures is incorrect. Got %d, Expected 0", code)
+	}
+	if code := reportFailures("group", ops, []error{nil, os.ErrPermission}); code != ExitPartialFailure {
+		t.Errorf("reportFailures with a failure is incorrect. Got %d, Expected %d", code, ExitPartialFailure)
+	}
+
+	skipped := []*Operation{{Source: "a.jpg", Action: ActionSkip}, {Source: "b.jpg", Action: ActionSkip, Conflict: true}}
+	if code := reportFailures("group", skipped, []error{nil, nil}); code != ExitConflicts {
+		t.Errorf("reportFailures with skipped conflicts is incorrect. Got %d, Expected %d", code, ExitConflicts)
+	}
+	if code := reportFailures("group", skipped[:1], []error{nil}); code != ExitNothingToDo {
+		t.Errorf("reportFailures with skipped files is incorrect. Got %d, Expected %d", code, ExitNothingToDo)
+	}
+}
+
+func TestExecutorStop(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.jpg")
+	os.WriteFile(source, nil, 0644)
+	ops := []*Operation{
+		{Source: source, Destination: filepath.Join(dir, "out", "a.jpg"), Action: ActionMove},
+		{Source: source, Destination: source, Action: ActionSkip},
+	}
+
+	executor := &Executor{Perm: 0755, Jobs: 1}
+	executor.Stop()
+	errs := executor.Execute(ops)
+	if errs[0] != errInterrupted || errs[1] != nil {
+		t.Errorf("Execute after Stop is incorrect. Got %v, Expected [%v <nil>]", errs, errInterrupted)
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Errorf("Execute after Stop should leave the files alone: %s", err)
+	}
+}
+
+func TestExecutorUnit(t *testing.T) {
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "IMG_1.jpg")
+	os.WriteFile(photo, []byte("photo"), 0644)
+	ops := []*Operation{
+		{Source: photo, Destination: filepath.Join(dir, "2019", "IMG_1.jpg"), Action: ActionMove},
+		// The sidecar is gone, so its file is put back
+		{Source: filepath.Join(dir, "IMG_1.xmp"), Destination: filepath.Join(dir, "2019", "IMG_1.xmp"), Action: ActionMove, Primary: photo},
+	}
+
+	journal := NewJournal(dir)
+	errs := (&Executor{Perm: 0755, Jobs: 4, Journal: journal}).Execute(ops)
+	journal.Close()
+
+	if errs[0] == nil || errs[1] == nil {
+		t.Errorf("Execute should fail both operations of the unit. Got %v", errs)
+	}
+	if _, err := os.Stat(photo); err != nil {
+		t.Errorf("Execute did not put back the file of the unit: %s", err)
+	}
+	if entries, _ := ReadJournal(journal.Path); len(entries) != 0 {
+		t.Errorf("Execute recorded %d operations of a failed unit, Expected 0", len(entries))
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	exifTagDateTime           = 0x0132
+	exifTagExifIFD            = 0x8769
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagOffsetTime         = 0x9010
+	exifTagOffsetTimeOriginal = 0x9011
+
+	exifTypeASCII = 2
+	exifTypeLong  = 4
+
+	// maxExifEntries guards against reading garbage as an IFD
+	maxExifEntries = 1024
+)
+
+// ReadExifTime returns the time a photo was taken according to its EXIF
+// metadata, read from a JPEG or TIFF based (e.g. most RAW formats) file.
+//
+// When the camera recorded the offset from UTC the time is returned in that
+// offset, otherwise the recorded wall clock time is read in loc.
+func ReadExifTime(filename string, loc *time.Location) (time.Time, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	base, err := findTIFFHeader(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return readTIFFTime(file, base, loc)
+}
+
+// findTIFFHeader returns the offset of the TIFF header holding the EXIF
+// metadata, which is either the start of the file or inside the APP1 segment
+// of a JPEG
+func findTIFFHeader(r io.ReaderAt) (int64, error) {
+	header := make([]byte, 4)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return 0, err
+	}
+	if bytes.Equal(header, []byte("II*\x00")) || bytes.Equal(header, []byte("MM\x00*")) {
+		return 0, nil
+	}
+	if header[0] != 0xFF || header[1] != 0xD8 {
+		return 0, groupbyError("Not a JPEG or TIFF file")
+	}
+
+	offset := int64(2)
+	segment := make([]byte, 10)
+	for {
+		if _, err := r.ReadAt(segment[:4], offset); err != nil {
+			return 0, err
+		}
+		marker := segment[1]
+		length := int64(binary.BigEndian.Uint16(segment[2:4]))
+		if segment[0] != 0xFF || marker == 0xDA || marker == 0xD9 {
+			// Start of the image data, there is no EXIF metadata
+			return 0, &GroupbyError{Code: CodeMissingDate, Message: "No EXIF metadata found"}
+		}
+		if marker == 0xE1 {
+			if _, err := r.ReadAt(segment, offset+4); err == nil && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				return offset + 10, nil
+			}
+		}
+		offset += 2 + length
+	}
+}
+
+// readTIFFTime reads the capture time from the IFDs of the TIFF structure
+// starting at base
+func readTIFFTime(r io.ReaderAt, base int64, loc *time.Location) (time.Time, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, base); err != nil {
+		return time.Time{}, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if header[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	ifd0, err := readIFD(r, base, int64(order.Uint32(header[4:])), order)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	dateTime, offset := ifd0.ascii(r, base, exifTagDateTime), ""
+	if pointer, ok := ifd0[exifTagExifIFD]; ok && pointer.kind == exifTypeLong {
+		exif, err := readIFD(r, base, int64(order.Uint32(pointer.value)), order)
+		if err == nil {
+			if original := exif.ascii(r, base, exifTagDateTimeOriginal); original != "" {
+				dateTime, offset = original, exif.ascii(r, base, exifTagOffsetTimeOriginal)
+			} else {
+				offset = exif.ascii(r, base, exifTagOffsetTime)
+			}
+		}
+	}
+	if dateTime == "" {
+		return time.Time{}, &GroupbyError{Code: CodeMissingDate, Message: "No date found in EXIF metadata"}
+	}
+
+	if offset != "" {
+		if tm, err := time.Parse("2006:01:02 15:04:05-07:00", dateTime+offset); err == nil {
+			return tm, nil
+		}
+	}
+	return time.ParseInLocation("2006:01:02 15:04:05", dateTime, loc)
+}
+
+type ifdEntry struct {
+	kind  uint16
+	count uint32
+	value []byte
+	order binary.ByteOrder
+}
+
+type ifd map[uint16]ifdEntry
+
+func readIFD(r io.ReaderAt, base, offset int64, order binary.ByteOrder) (ifd, error) {
+	countBytes := make([]byte, 2)
+	if _, err := r.ReadAt(countBytes, base+offset); err != nil {
+		return nil, err
+	}
+	count := int(order.Uint16(countBytes))
+	if count > maxExifEntries {
+		return nil, groupbyError("Invalid EXIF metadata")
+	}
+
+	entries := make([]byte, 12*count)
+	if _, err := r.ReadAt(entries, base+offset+2); err != nil {
+		return nil, err
+	}
+	result := ifd{}
+	for i := 0; i < count; i++ {
+		entry := entries[12*i : 12*(i+1)]
+		result[order.Uint16(entry)] = ifdEntry{
+			kind:  order.Uint16(entry[2:]),
+			count: order.Uint32(entry[4:]),
+			value: entry[8:12],
+			order: order,
+		}
+	}
+	return result, nil
+}
+
+// ascii returns the value of an ASCII tag, or an empty string if the tag is
+// missing or can't be read
+func (d ifd) ascii(r io.ReaderAt, base int64, tag uint16) string {
+	entry, ok := d[tag]
+	if !ok || entry.kind != exifTypeASCII || entry.count > 64 {
+		return ""
+	}
+	value := entry.value
+	if entry.count > 4 {
+		value = make([]byte, entry.count)
+		if _, err := r.ReadAt(value, base+int64(entry.order.Uint32(entry.value))); err != nil {
+			return ""
+		}
+	}
+	if int(entry.count) < len(value) {
+		value = value[:entry.count]
+	}
+	return strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+}
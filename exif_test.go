@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// exifJPEG returns a minimal JPEG holding only the EXIF DateTimeOriginal and
+// OffsetTimeOriginal tags
+func exifJPEG(dateTime, offset string) []byte {
+	le := binary.LittleEndian
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("II*\x00")
+	binary.Write(tiff, le, uint32(8))
+
+	// IFD0 pointing to the Exif IFD at 26
+	binary.Write(tiff, le, uint16(1))
+	binary.Write(tiff, le, []uint16{exifTagExifIFD, exifTypeLong})
+	binary.Write(tiff, le, []uint32{1, 26, 0})
+
+	// Exif IFD with the values stored from 56 onwards
+	binary.Write(tiff, le, uint16(2))
+	binary.Write(tiff, le, []uint16{exifTagDateTimeOriginal, exifTypeASCII})
+	binary.Write(tiff, le, []uint32{uint32(len(dateTime) + 1), 56})
+	binary.Write(tiff, le, []uint16{exifTagOffsetTimeOriginal, exifTypeASCII})
+	binary.Write(tiff, le, []uint32{uint32(len(offset) + 1), uint32(56 + len(dateTime) + 1)})
+	binary.Write(tiff, le, uint32(0))
+	tiff.WriteString(dateTime + "\x00" + offset + "\x00")
+
+	jpeg := new(bytes.Buffer)
+	jpeg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(jpeg, binary.BigEndian, uint16(2+6+tiff.Len()))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiff.Bytes())
+	jpeg.Write([]byte{0xFF, 0xD9})
+	return jpeg.Bytes()
+}
+
+func TestReadExifTime(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		offset   string
+		expected time.Time
+	}{
+		{"+02:00", time.Date(2019, time.June, 1, 21, 30, 0, 0, time.UTC)},
+		{"", time.Date(2019, time.June, 1, 23, 30, 0, 0, time.UTC)},
+	}
+
+	for i, test := range tests {
+		filename := filepath.Join(dir, "photo"+string(rune('a'+i))+".jpg")
+		if err := os.WriteFile(filename, exifJPEG("2019:06:01 23:30:00", test.offset), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tm, err := ReadExifTime(filename, time.UTC)
+		if err != nil {
+			t.Errorf("ReadExifTime with offset '%s' returned an error: %s", test.offset, err)
+			continue
+		}
+		if !tm.Equal(test.expected) {
+			t.Errorf("ReadExifTime with offset '%s' is incorrect. Got '%s', Expected '%s'", test.offset, tm, test.expected)
+		}
+	}
+}
+
+func TestReadExifTimeWithoutExif(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(filename, []byte("not a photo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadExifTime(filename, time.UTC); err == nil {
+		t.Errorf("ReadExifTime should fail for a file without EXIF metadata")
+	}
+}
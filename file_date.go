@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources a file's date can be read from, tried in the order given to
+// -date-source
+const (
+	DateSourceExif     = "exif"
+	DateSourceModified = "modified"
+)
+
+// ParseDateSources parses a comma separated list of date sources such as
+// "exif,modified"
+func ParseDateSources(value string) ([]string, error) {
+	var sources []string
+	for _, source := range strings.Split(value, ",") {
+		source = strings.ToLower(strings.TrimSpace(source))
+		switch source {
+		case DateSourceExif, DateSourceModified:
+			sources = append(sources, source)
+		case "":
+		default:
+			return nil, groupbyError("Unknown date source '" + source + "', expected one of exif, modified")
+		}
+	}
+	if len(sources) == 0 {
+		return nil, groupbyError("No date source specified")
+	}
+	return sources, nil
+}
+
+// FileDate returns the date of the file, read from the first of the
+// dateSources that has one, along with the name of that source. The
+// modification time is used when none of them do.
+func FileDate(filename string, fileInfo os.FileInfo) (time.Time, string) {
+	for _, source := range dateSources {
+		switch source {
+		case DateSourceExif:
+			if fileInfo.IsDir() {
+				continue
+			}
+			if tm, err := ReadExifTime(filename, location); err == nil {
+				return tm, DateSourceExif
+			}
+		case DateSourceModified:
+			return fileInfo.ModTime(), DateSourceModified
+		}
+	}
+	return fileInfo.ModTime(), DateSourceModified
+}
+
+// BucketTime returns the time used to decide which year, month and day a
+// file is grouped into: tm in the zone chosen with -tz, shifted so the day
+// starts at -day-starts-at instead of midnight
+func BucketTime(tm time.Time) time.Time {
+	return tm.In(location).Add(-dayOffset)
+}
+
+// BucketYMD returns the year, month and day tm is grouped into
+func BucketYMD(tm time.Time) (int, time.Month, int) {
+	tm = BucketTime(tm)
+	return tm.Year(), tm.Month(), tm.Day()
+}
+
+// ParseTimeZone returns the location for a -tz value: an IANA zone name
+// (e.g. Africa/Blantyre), UTC, Local or a fixed offset such as +02:00
+func ParseTimeZone(name string) (*time.Location, error) {
+	if name == "" || strings.EqualFold(name, "local") {
+		return time.Local, nil
+	}
+	if strings.EqualFold(name, "utc") {
+		return time.UTC, nil
+	}
+	if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+		offset, err := parseClock(name[1:])
+		if err != nil {
+			return nil, groupbyError("Invalid time zone offset '" + name + "'")
+		}
+		if name[0] == '-' {
+			offset = -offset
+		}
+		return time.FixedZone(name, int(offset/time.Second)), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, groupbyError("Unknown time zone '" + name + "'")
+	}
+	return loc, nil
+}
+
+// ParseDayStart parses a -day-starts-at value such as 04:00 into the offset
+// from midnight
+func ParseDayStart(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	offset, err := parseClock(value)
+	if err != nil || offset >= 24*time.Hour {
+		return 0, groupbyError("Invalid day start '" + value + "', expected a time such as 04:00")
+	}
+	return offset, nil
+}
+
+// parseClock parses hh:mm (or hhmm) into a duration
+func parseClock(value string) (time.Duration, error) {
+	hours, minutes := value, "0"
+	if i := strings.Index(value, ":"); i >= 0 {
+		hours, minutes = value[:i], value[i+1:]
+	} else if len(value) == 4 {
+		hours, minutes = value[:2], value[2:]
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil || h < 0 {
+		return 0, groupbyError("Invalid hour")
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 || m > 59 {
+		return 0, groupbyError("Invalid minutes")
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeZone(t *testing.T) {
+	tests := []struct {
+		input  string
+		offset int
+		valid  bool
+	}{
+		{"UTC", 0, true},
+		{"+02:00", 2 * 60 * 60, true},
+		{"-0530", -(5*60 + 30) * 60, true},
+		{"+2:75", 0, false},
+		{"Not/AZone", 0, false},
+	}
+
+	for _, test := range tests {
+		loc, err := ParseTimeZone(test.input)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseTimeZone(\"%s\") validity is incorrect. Got error '%v'", test.input, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if _, offset := time.Date(2019, time.June, 1, 0, 0, 0, 0, loc).Zone(); offset != test.offset {
+			t.Errorf("ParseTimeZone(\"%s\") offset is incorrect. Got '%d', Expected '%d'", test.input, offset, test.offset)
+		}
+	}
+}
+
+func TestBucketYMD(t *testing.T) {
+	defer func() {
+		location, dayOffset = time.Local, 0
+	}()
+
+	tm := time.Date(2019, time.June, 1, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		zone     string
+		dayStart string
+		day      int
+	}{
+		{"UTC", "", 1},
+		{"+02:00", "", 2},
+		{"+02:00", "04:00", 1},
+		{"UTC", "00:00", 1},
+	}
+
+	for _, test := range tests {
+		location, _ = ParseTimeZone(test.zone)
+		offset, err := ParseDayStart(test.dayStart)
+		if err != nil {
+			t.Errorf("ParseDayStart(\"%s\") returned an error: %s", test.dayStart, err)
+		}
+		dayOffset = offset
+		if _, _, day := BucketYMD(tm); day != test.day {
+			t.Errorf("BucketYMD in zone '%s' with day starting at '%s' is incorrect. Got '%d', Expected '%d'", test.zone, test.dayStart, day, test.day)
+		}
+	}
+}
+
+func TestParseDateSources(t *testing.T) {
+	sources, err := ParseDateSources("exif, modified")
+	if err != nil || len(sources) != 2 || sources[0] != DateSourceExif || sources[1] != DateSourceModified {
+		t.Errorf("ParseDateSources(\"exif, modified\") is incorrect. Got %v, %v", sources, err)
+	}
+	if _, err := ParseDateSources("created"); err == nil {
+		t.Errorf("ParseDateSources(\"created\") should fail")
+	}
+}
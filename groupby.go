@@ -1,12 +1,11 @@
 package main
 
-// Currently 19.1% test coverage
-
 import (
 	"flag"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -35,35 +34,129 @@ var (
 	filterPattern     string = ""
 	verbose           bool
 	showVersion       bool
+	events            bool
+	eventGap          time.Duration = 3 * time.Hour
+	eventLabel        string
+	icsFile           string
+	calendarEvents    []CalendarEvent
+	timeZone          string
+	location          *time.Location = time.Local
+	dayStartsAt       string
+	dayOffset         time.Duration
+	dateSource        string   = DateSourceModified
+	dateSources       []string = []string{DateSourceModified}
+	localeName        string   = "en"
+	localeFile        string
+	monthFormat       string
+	dayFormat         string
+	outputFormat      string
+	conflictPolicy    string = ConflictSkip
+	duplicatePolicy   string = DuplicatesNone
+	sidecarExtensions string
+	settleInterval    time.Duration = 5 * time.Second
+	pollInterval      time.Duration = 2 * time.Second
+	watchExisting     bool
+	includeGrouped    bool
+	jobs              int    = 1
+	progressMode      string = ProgressAuto
+	failFast          bool
+	verifyCopies      bool
+	hashAlgorithm     string = HashSHA256
+	writeManifests    bool
+	progressInterval  time.Duration
 	version           string = "0.0.0"
 )
 
 func init() {
-	flag.StringVar(&directory, "d", "", "\tDirectory containing files to group")
-	flag.StringVar(&outputDirectory, "o", "", "\tDirectory to move grouped files to")
-	flag.StringVar(&filterPattern, "e", "", "\tOnly group files matching the given pattern")
-	flag.StringVar(&filterPattern, "pattern", "", "\tOnly group files matching the given pattern")
-	flag.BoolVar(&copyOnly, "copy-only", false, "\tOnly copy files, do not move them")
-	flag.BoolVar(&ignoreDirectories, "ignore-directories", false, "\tIgnore directories and only group files")
-	flag.BoolVar(&created, "created", false, "\tGroup files by the date they were created")
-	flag.BoolVar(&modified, "modified", true, "\tGroup files by the date they were modified")
-	flag.BoolVar(&year, "year", false, "\tGroup by year only")
-	flag.BoolVar(&month, "month", false, "\tGroup by year, and then month")
-	flag.BoolVar(&day, "day", false, "\tGroup by year, month and then day")
-	flag.BoolVar(&flatten, "flatten", false, "\tFlatten the created directory tree folders")
+	addGroupingFlags(flag.CommandLine)
 	flag.BoolVar(&dryRun, "dry-run", false, "\tOnly show the output of how the files will be grouped")
 	flag.BoolVar(&dryRun, "preview", false, "\tOnly show the output of how the files will be grouped")
 	flag.BoolVar(&dryRun, "p", false, "\tOnly show the output of how the files will be grouped (shorthand)")
-	flag.BoolVar(&expandMonth, "expand-month", true, "\tUse the English name of the month (e.g. March) instead of the numeric value (default true)")
-	flag.BoolVar(&includeHidden, "a", false, "\tInclude hidden files and directories (starting with .)")
+	addFormatFlag(flag.CommandLine)
+	addVerboseFlags(flag.CommandLine)
+	addJobsFlag(flag.CommandLine)
+	addProgressFlags(flag.CommandLine)
+	addFailFastFlag(flag.CommandLine)
+	addVerifyFlags(flag.CommandLine)
+	flag.BoolVar(&showVersion, "version", false, "\tShow the program version and exit")
+}
+
+// addGroupingFlags registers the flags choosing which files are grouped and
+// how on the flag set of a command
+func addGroupingFlags(flags *flag.FlagSet) {
+	flags.StringVar(&directory, "d", "", "\tDirectory containing files to group")
+	flags.StringVar(&outputDirectory, "o", "", "\tDirectory to move grouped files to")
+	flags.StringVar(&filterPattern, "e", "", "\tOnly group files matching the given pattern")
+	flags.StringVar(&filterPattern, "pattern", "", "\tOnly group files matching the given pattern")
+	flags.BoolVar(&copyOnly, "copy-only", false, "\tOnly copy files, do not move them")
+	flags.BoolVar(&ignoreDirectories, "ignore-directories", false, "\tIgnore directories and only group files")
+	flags.BoolVar(&created, "created", false, "\tGroup files by the date they were created")
+	flags.BoolVar(&modified, "modified", true, "\tGroup files by the date they were modified")
+	flags.BoolVar(&year, "year", false, "\tGroup by year only")
+	flags.BoolVar(&month, "month", false, "\tGroup by year, and then month")
+	flags.BoolVar(&day, "day", false, "\tGroup by year, month and then day")
+	flags.BoolVar(&flatten, "flatten", false, "\tFlatten the created directory tree folders")
+	flags.BoolVar(&expandMonth, "expand-month", true, "\tUse the English name of the month (e.g. March) instead of the numeric value (default true)")
+	addConfigFlags(flags)
+	flags.BoolVar(&includeHidden, "a", false, "\tInclude hidden files and directories (starting with .)")
+	flags.BoolVar(&includeGrouped, "include-grouped", false, "\tAlso group the folders files were grouped into by earlier runs into the same directory")
 	// flag.String(&exclude, "exclude", "Exclude files or directory matching a specified pattern")
 	// flag.BoolVar(&recurse, "R", "recurse" "Group files in subdirectories")
-	flag.BoolVar(&verbose, "verbose", false, "\tShow verbose output")
-	flag.BoolVar(&verbose, "v", false, "\tShow verbose output")
-	flag.BoolVar(&showVersion, "version", false, "\tShow the program version and exit")
+	flags.BoolVar(&events, "events", false, "\tGroup files into events, starting a new event when files are further apart than -event-gap")
+	flags.DurationVar(&eventGap, "event-gap", 3*time.Hour, "\tTime between files that starts a new event (used with -events)")
+	flags.StringVar(&eventLabel, "event-label", "", "\tLabel appended to the name of event folders (used with -events)")
+	flags.StringVar(&timeZone, "tz", "", "\tTime zone used to decide which day a file belongs to, e.g. UTC, Europe/Berlin or +02:00 (default local)")
+	flags.StringVar(&dayStartsAt, "day-starts-at", "", "\tTime of day the day starts at, e.g. 04:00 to group files until 4am with the previous day")
+	flags.StringVar(&dateSource, "date-source", DateSourceModified, "\tComma separated sources of the date to group files by, tried in order: exif, modified")
+	flags.StringVar(&monthFormat, "month-format", "", "\tFormat of month folder names: "+strings.Join(monthFormats, ", ")+" (overrides -expand-month)")
+	flags.StringVar(&dayFormat, "day-format", "", "\tFormat of day folder names: "+strings.Join(dayFormats, ", ")+" (default 2)")
+	flags.StringVar(&localeName, "locale", "en", "\tLanguage of month and weekday names in folder names: "+strings.Join(LocaleNames(), ", "))
+	flags.StringVar(&localeFile, "locale-file", "", "\tFile with the month and weekday names to use in folder names")
+	flags.StringVar(&conflictPolicy, "on-conflict", ConflictSkip, "\tWhat to do when a different file already exists at the destination: "+strings.Join(conflictPolicies, ", "))
+	flags.StringVar(&duplicatePolicy, "duplicates", DuplicatesNone, "\tWhat to do with files with the same content as another file: "+strings.Join(duplicatePolicies, ", "))
+	flags.StringVar(&sidecarExtensions, "sidecars", "", "\tComma separated extensions of the files grouped with the file of the same name, in order of precedence, e.g. cr2,xmp (default none)")
+	flags.StringVar(&icsFile, "ics", "", "\tGroup files taken during the events of an iCalendar (.ics) file into folders named after the events")
+}
+
+func addFormatFlag(flags *flag.FlagSet) {
+	flags.StringVar(&outputFormat, "format", "", "\tOnly show how the files will be grouped in a machine-readable format: "+strings.Join(outputFormats, ", "))
+}
+
+func addJobsFlag(flags *flag.FlagSet) {
+	flags.IntVar(&jobs, "jobs", 1, "\tNumber of files to move or copy at the same time")
+}
+
+// validateExecutionFlags returns an error if the value of -progress or -hash
+// is unknown
+func validateExecutionFlags() error {
+	if err := ValidateProgressMode(progressMode); err != nil {
+		return err
+	}
+	return ValidateHashAlgorithm(hashAlgorithm)
+}
+
+func addProgressFlags(flags *flag.FlagSet) {
+	flags.StringVar(&progressMode, "progress", ProgressAuto, "\tProgress shown on stderr while grouping: "+strings.Join(progressModes, ", ")+" (auto shows a line on terminals)")
+	flags.DurationVar(&progressInterval, "progress-interval", time.Second, "\tInterval json progress lines are written at (used with -progress json)")
+}
+
+func addFailFastFlag(flags *flag.FlagSet) {
+	flags.BoolVar(&failFast, "fail-fast", false, "\tStop at the first file that can't be moved or copied instead of going on with the others")
+}
+
+func addVerifyFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&verifyCopies, "verify", false, "\tCompare the checksums of files copied to another file system with their source before removing it, and record them in the journal")
+	flags.StringVar(&hashAlgorithm, "hash", HashSHA256, "\tHash used by -verify: "+strings.Join(hashAlgorithms, ", ")+" (fast is CRC-64)")
+	flags.BoolVar(&writeManifests, "manifest", false, "\tWrite the checksums of the files grouped into each folder to a "+manifestName+" file in it")
+}
+
+func addVerboseFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&verbose, "verbose", false, "\tShow verbose output")
+	flags.BoolVar(&verbose, "v", false, "\tShow verbose output")
 }
 
-// MonthAsName returns the full month name for the provided monthStr
+// MonthAsName returns the full month name for the provided monthStr in the
+// chosen locale
 //
 // monthStr is a string usually containing the numeric representation of a
 // month (with January=1, February=2, etc.)
@@ -81,7 +174,7 @@ func MonthAsName(monthStr string) string {
 		return ""
 	}
 
-	return time.Month(monthIdx).String()
+	return currentLocale.Month(time.Month(monthIdx))
 }
 
 // FileNameByDepth returns the filename, potentially modified depending on
@@ -90,86 +183,34 @@ func MonthAsName(monthStr string) string {
 // filename is a string containing the name of the file
 //
 // Depth is how deep down the file structure this file will be. The second
-// level is mapped to the month, so the name may be updated to its string representation.
+// level is mapped to the month, so the name may be updated to its string
+// representation or the format chosen with -month-format.
 func FileNameByDepth(filename string, depth int) string {
-	if depth != 2 || expandMonth == false {
+	format := monthNameFormat()
+	if depth != 2 || format == "" {
 		return filename
 	}
 
-	return MonthAsName(filename)
-}
-
-// Adapted from: https://stackoverflow.com/a/21067803
-// moveOrCopyFile moves or copies a file from src to dst.
-// If src and dst files exist, and are the same, then return success.
-// Attempt to move the file using os.Rename if the copyOnly flag is false
-// Otherwise, we attempt to create a hard link between the two files.
-func moveOrCopyFile(src, dst string) (err error) {
-	if verbose {
-		fmt.Println("Moving from=", src, " to=", dst)
-	}
-	sfi, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-	if ignoreDirectories && sfi.Mode().IsDir() {
-		return
-	}
-	dfi, err := os.Stat(dst)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
-	} else {
-		if os.SameFile(sfi, dfi) {
-			return
-		}
-	}
-	// User wants to actually move the files
-	if !copyOnly {
-		if err = os.Rename(src, dst); err == nil {
-			return
-		}
-		return err
-	}
-	// User wants to -copy-only the files/directories
-	// Creates a hardlink to the source
-	if err = os.Link(src, dst); err == nil {
-		return
+	monthIdx, err := strconv.Atoi(filename)
+	if err != nil || monthIdx < 1 || monthIdx > 12 {
+		return MonthAsName(filename)
 	}
-	return err
+	return FormatMonth(format, time.Month(monthIdx))
 }
 
-func GetYMD(fileName string) (int, time.Month, int) {
-	var stat, err = os.Stat(fileName)
-
+// GetYMD returns the year, month and day the file was modified
+func GetYMD(fileName string) (int, time.Month, int, error) {
+	stat, err := os.Stat(fileName)
 	if err != nil {
-		// raise error here
-		panic(err)
+		return 0, 0, 0, err
 	}
 	var tm = stat.ModTime()
-	return tm.Year(), tm.Month(), tm.Day()
-}
-
-func GetFileInfoYMD(fileInfo os.FileInfo) (int, time.Month, int) {
-	var tm = fileInfo.ModTime()
-	return tm.Year(), tm.Month(), tm.Day()
+	return tm.Year(), tm.Month(), tm.Day(), nil
 }
 
-func main() {
-	flag.Parse()
-
-	if showVersion {
-		fmt.Println("groupby ", version, " - Group files and directories by the date they were created or modified")
-		fmt.Println("By Zikani Nyirenda Mwase ")
-		os.Exit(0)
-	}
-
-	if _, err := os.Stat(directory); err != nil {
-		flag.PrintDefaults()
-		os.Exit(0)
-	}
-
+// configure checks the grouping flags and loads what they refer to. It must
+// be called after the flags are parsed and before the tree is built.
+func configure() error {
 	if outputDirectory == "" {
 		outputDirectory = directory
 	}
@@ -183,25 +224,64 @@ func main() {
 		depth = 1
 	}
 
-	// TODO: Add argument to tree constructor for which file time to use
-	var tree = NewTree(directory, depth)
-	err := tree.Build()
-	if err != nil {
-		fmt.Printf("Error: %s", err)
-		os.Exit(-1)
-	}
-	printingVisitor := NewPrintingVisitor()
-	if dryRun {
-		tree.Visit(printingVisitor)
-		fmt.Printf("\n%d directories, %d files\n", tree.Directories(), tree.Files())
-		os.Exit(-1)
-		return
-	}
-	directoryVisitor := NewDirectoryVisitor(directory, flatten, depth)
-	multiVisitor := NewVisitors(printingVisitor, directoryVisitor)
-	if verbose {
-		tree.Visit(multiVisitor)
+	if events {
+		if eventGap <= 0 {
+			return groupbyError("-event-gap must be greater than zero")
+		}
+		// Events are a single level of folders
+		depth = 1
+	}
+
+	var err error
+	if location, err = ParseTimeZone(timeZone); err != nil {
+		return err
+	}
+	if dayOffset, err = ParseDayStart(dayStartsAt); err != nil {
+		return err
+	}
+	if dateSources, err = ParseDateSources(dateSource); err != nil {
+		return err
+	}
+
+	if monthFormat != "" {
+		if err = ValidateMonthFormat(monthFormat); err != nil {
+			return err
+		}
+	}
+	if dayFormat != "" {
+		if err = ValidateDayFormat(dayFormat); err != nil {
+			return err
+		}
+	}
+	if err = ValidateConflictPolicy(conflictPolicy); err != nil {
+		return err
+	}
+	if err = ValidateDuplicatePolicy(duplicatePolicy); err != nil {
+		return err
+	}
+	if err = validateExecutionFlags(); err != nil {
+		return err
+	}
+	if outputFormat != "" {
+		if err = ValidateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+	}
+
+	if localeFile != "" {
+		currentLocale, err = LoadLocaleFile(localeFile)
 	} else {
-		tree.Visit(directoryVisitor)
+		currentLocale, err = LookupLocale(localeName)
+	}
+	if err != nil {
+		return err
+	}
+
+	if icsFile != "" {
+		calendarEvents, err = LoadICS(icsFile)
+		if err != nil {
+			return fmt.Errorf("failed to read calendar %s: %w", icsFile, err)
+		}
 	}
+	return nil
 }
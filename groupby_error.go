@@ -1,15 +1,129 @@
 package main
 
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Codes of the kinds of errors groupby reports
+const (
+	CodeInvalidPattern      = "invalid-pattern"
+	CodeUnreadableSource    = "unreadable-source"
+	CodeDestinationConflict = "destination-conflict"
+	CodeCrossDevice         = "cross-device"
+	CodePermissionDenied    = "permission-denied"
+	CodeMissingDate         = "missing-date"
+	CodeChecksumMismatch    = "checksum-mismatch"
+	// CodeInvalidOption is the code of the errors of option values
+	CodeInvalidOption = "invalid-option"
+)
+
+// The errors of each code, for errors.Is, e.g. errors.Is(err, ErrCrossDevice)
+var (
+	ErrInvalidPattern      = &GroupbyError{Code: CodeInvalidPattern}
+	ErrUnreadableSource    = &GroupbyError{Code: CodeUnreadableSource}
+	ErrDestinationConflict = &GroupbyError{Code: CodeDestinationConflict}
+	ErrCrossDevice         = &GroupbyError{Code: CodeCrossDevice}
+	ErrPermissionDenied    = &GroupbyError{Code: CodePermissionDenied}
+	ErrMissingDate         = &GroupbyError{Code: CodeMissingDate}
+	ErrChecksumMismatch    = &GroupbyError{Code: CodeChecksumMismatch}
+	ErrInvalidOption       = &GroupbyError{Code: CodeInvalidOption}
+)
+
+// GroupbyError is an error of groupby. Code is the kind of error, empty if
+// it has none, Path the file it is about and Err the error it wraps, such as
+// an *os.PathError.
 type GroupbyError struct {
+	Code    string
 	Message string
+	Path    string
+	Err     error
 }
 
-func groupbyError(msg string) GroupbyError {
-	return GroupbyError{
+func groupbyError(msg string) *GroupbyError {
+	return &GroupbyError{
 		Message: msg,
 	}
 }
 
-func (e GroupbyError) Error() string {
-	return e.Message
+// codedError returns an error of the code about the file at path, wrapping
+// err
+func codedError(code, path string, err error) *GroupbyError {
+	return &GroupbyError{
+		Code: code,
+		Path: path,
+		Err:  err,
+	}
+}
+
+// invalidOption returns err, an error of an option value, with the
+// invalid-option code unless it has a code already
+func invalidOption(err error) error {
+	if ErrorCode(err) != "" {
+		return err
+	}
+	return &GroupbyError{Code: CodeInvalidOption, Err: err}
+}
+
+func (e *GroupbyError) Error() string {
+	switch {
+	case e.Message != "" && e.Err != nil:
+		return e.Message + ": " + e.Err.Error()
+	case e.Message != "":
+		return e.Message
+	case e.Err != nil:
+		return e.Err.Error()
+	}
+	return e.Code
+}
+
+func (e *GroupbyError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if target is the error of e's code, such as ErrCrossDevice
+func (e *GroupbyError) Is(target error) bool {
+	t, ok := target.(*GroupbyError)
+	return ok && t.Code != "" && t.Code == e.Code && t.Message == "" && t.Err == nil
+}
+
+// ErrorCode returns the code of err or of the first error it wraps that has
+// one, or an empty string
+func ErrorCode(err error) string {
+	for err != nil {
+		if e, ok := err.(*GroupbyError); ok && e.Code != "" {
+			return e.Code
+		}
+		err = errors.Unwrap(err)
+	}
+	return ""
+}
+
+// operationError returns the error of the operation with the code of its
+// cause, or err as is if it already has a code or its cause isn't known
+func operationError(op *Operation, err error) error {
+	if err == nil || ErrorCode(err) != "" {
+		return err
+	}
+	path := op.Destination
+	var code string
+	switch {
+	case errors.Is(err, syscall.EXDEV):
+		code = CodeCrossDevice
+	case errors.Is(err, os.ErrPermission):
+		code = CodePermissionDenied
+	case errors.Is(err, os.ErrExist):
+		code = CodeDestinationConflict
+	case errors.Is(err, os.ErrNotExist) && !sourceExists(op.Source):
+		code, path = CodeUnreadableSource, op.Source
+	default:
+		return err
+	}
+	return codedError(code, path, err)
+}
+
+func sourceExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
 }
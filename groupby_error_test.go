@@ -1,6 +1,13 @@
 package main
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
 
 func TestGroupbyError(t *testing.T) {
 	tests := []struct {
@@ -18,3 +25,58 @@ func TestGroupbyError(t *testing.T) {
 		}
 	}
 }
+
+func TestGroupbyErrorCodes(t *testing.T) {
+	pathErr := &os.PathError{Op: "rename", Path: "a.jpg", Err: syscall.EXDEV}
+	err := fmt.Errorf("grouping: %w", codedError(CodeCrossDevice, "a.jpg", pathErr))
+
+	if !errors.Is(err, ErrCrossDevice) {
+		t.Errorf("errors.Is(err, ErrCrossDevice) should be true for %v", err)
+	}
+	if errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("errors.Is(err, ErrPermissionDenied) should be false for %v", err)
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		t.Errorf("errors.Is(err, syscall.EXDEV) should be true, the os error is wrapped")
+	}
+	var groupbyErr *GroupbyError
+	if !errors.As(err, &groupbyErr) || groupbyErr.Path != "a.jpg" {
+		t.Errorf("errors.As(err, *GroupbyError) is incorrect. Got %v", groupbyErr)
+	}
+	if code := ErrorCode(err); code != CodeCrossDevice {
+		t.Errorf("ErrorCode is incorrect. Got '%s', Expected '%s'", code, CodeCrossDevice)
+	}
+	if code := ErrorCode(groupbyError("no code")); code != "" {
+		t.Errorf("ErrorCode of an error without a code is incorrect. Got '%s', Expected ''", code)
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.jpg")
+	os.WriteFile(source, nil, 0644)
+	op := &Operation{Source: source, Destination: filepath.Join(dir, "2019", "a.jpg")}
+	missing := &Operation{Source: filepath.Join(dir, "missing.jpg"), Destination: filepath.Join(dir, "2019", "missing.jpg")}
+
+	tests := []struct {
+		op       *Operation
+		err      error
+		expected string
+	}{
+		{op: op, err: &os.LinkError{Op: "rename", Old: source, New: op.Destination, Err: syscall.EXDEV}, expected: CodeCrossDevice},
+		{op: op, err: &os.PathError{Op: "mkdir", Path: dir, Err: syscall.EACCES}, expected: CodePermissionDenied},
+		{op: op, err: &os.LinkError{Op: "link", Old: source, New: op.Destination, Err: syscall.EEXIST}, expected: CodeDestinationConflict},
+		{op: missing, err: &os.LinkError{Op: "rename", Old: missing.Source, New: missing.Destination, Err: syscall.ENOENT}, expected: CodeUnreadableSource},
+		{op: op, err: &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}, expected: ""},
+	}
+
+	for _, test := range tests {
+		err := operationError(test.op, test.err)
+		if code := ErrorCode(err); code != test.expected {
+			t.Errorf("operationError(%v) code is incorrect. Got '%s', Expected '%s'", test.err, code, test.expected)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("operationError(%v) should wrap the error", test.err)
+		}
+	}
+}
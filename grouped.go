@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GroupedFolders returns the names of the folders of outputDir that its
+// journals record files being grouped into
+func GroupedFolders(outputDir string) map[string]bool {
+	folders := map[string]bool{}
+	root, err := filepath.Abs(outputDir)
+	if err != nil {
+		return folders
+	}
+	journals, _ := filepath.Glob(filepath.Join(journalDir(outputDir), "*"+journalExtension))
+	for _, journal := range journals {
+		entries, err := ReadJournal(journal)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			rel, err := filepath.Rel(root, entry.Destination)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			if parts := strings.Split(filepath.ToSlash(rel), "/"); len(parts) > 1 {
+				folders[parts[0]] = true
+			}
+		}
+	}
+	return folders
+}
+
+// SkipGrouped makes the tree leave alone the folders groupby grouped files
+// into when outputDir is the tree's directory, so new files are grouped into
+// the existing folders instead of the folders being grouped again. Folders
+// are recognized from the journals and by their names.
+func (t *Tree) SkipGrouped(outputDir string) {
+	output, err := filepath.Abs(outputDir)
+	if err != nil || output != t.Root.FileName {
+		return
+	}
+	t.grouped = GroupedFolders(outputDir)
+}
+
+// isGrouped returns true if the entry is a folder of the tree's directory
+// that groupby grouped files into: a folder recorded in the journals, or one
+// named like the folders groupby creates on the first level, such as years,
+// flattened dates like 2019-July-5 and events like 2019-07-05 14.30. Folders
+// such as 2021-taxes are not.
+func (t *Tree) isGrouped(f os.FileInfo) bool {
+	if t.grouped == nil || !f.IsDir() {
+		return false
+	}
+	if t.grouped[f.Name()] || f.Name() == duplicatesDirName {
+		return true
+	}
+	_, ok := parseBucket([]string{f.Name()})
+	return ok
+}
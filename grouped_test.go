@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSkipGrouped(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"Lake trip", "2019", "2019-July-5", "2019-07-05 14.30 Lake", "2021-taxes", "Photos", "new.jpg"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal := NewJournal(dir)
+	op := &Operation{Source: filepath.Join(dir, "a.jpg"), Destination: filepath.Join(dir, "Lake trip", "a.jpg"), Action: ActionMove}
+	if err := journal.Record(op); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	tests := []struct {
+		output   string
+		expected map[string]bool
+	}{
+		// 2021-taxes starts with a year, but isn't named like a date
+		{dir, map[string]bool{"2021-taxes": true, "Photos": true, "new.jpg": true}},
+		{filepath.Join(dir, "out"), map[string]bool{"Lake trip": true, "2019": true, "2019-July-5": true, "2019-07-05 14.30 Lake": true, "2021-taxes": true, "Photos": true, "new.jpg": true}},
+	}
+
+	for _, test := range tests {
+		tree, err := NewTree(dir, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.SkipGrouped(test.output)
+		if err := tree.Build(); err != nil {
+			t.Fatal(err)
+		}
+		visitor := NewPlanVisitor(dir, test.output, false)
+		tree.Visit(visitor)
+
+		got := map[string]bool{}
+		for _, op := range visitor.Operations {
+			got[filepath.Base(op.Source)] = true
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("Entries grouped into %s are incorrect. Got %v, Expected %v", test.output, got, test.expected)
+		}
+		for name := range test.expected {
+			if !got[name] {
+				t.Errorf("Entries grouped into %s are incorrect. Got %v, Expected %v", test.output, got, test.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarEvent is a VEVENT read from an iCalendar (.ics) file
+type CalendarEvent struct {
+	Summary string
+	Start   time.Time
+	End     time.Time
+	AllDay  bool
+}
+
+// Contains returns true if tm falls within the event. The end of an event is
+// exclusive, as it is in iCalendar.
+func (e CalendarEvent) Contains(tm time.Time) bool {
+	if tm.Before(e.Start) {
+		return false
+	}
+	if e.End.After(e.Start) {
+		return tm.Before(e.End)
+	}
+	return tm.Equal(e.Start)
+}
+
+// FolderName returns the name of the folder files taken during the event are
+// grouped into
+func (e CalendarEvent) FolderName() string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '-'
+		}
+		if r < ' ' {
+			return ' '
+		}
+		return r
+	}, e.Summary)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "Untitled event"
+	}
+	return name
+}
+
+// FindCalendarEvent returns the event tm falls within. If several events
+// overlap, the shortest one is returned as it is the most specific.
+func FindCalendarEvent(events []CalendarEvent, tm time.Time) *CalendarEvent {
+	var found *CalendarEvent
+	for i := range events {
+		e := &events[i]
+		if !e.Contains(tm) {
+			continue
+		}
+		if found == nil || e.End.Sub(e.Start) < found.End.Sub(found.Start) {
+			found = e
+		}
+	}
+	return found
+}
+
+// LoadICS reads the events from the iCalendar file at filename
+func LoadICS(filename string) ([]CalendarEvent, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseICS(file)
+}
+
+// ParseICS reads the VEVENTs from an iCalendar stream. Only the DTSTART,
+// DTEND, DURATION and SUMMARY properties are used. Times without a zone are
+// read in the zone chosen with -tz, as are all-day events.
+func ParseICS(r io.Reader) ([]CalendarEvent, error) {
+	lines, err := unfoldICSLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []CalendarEvent
+	var current *CalendarEvent
+	var duration time.Duration
+	for lineNo, line := range lines {
+		name, params, value := splitICSLine(line)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			current = &CalendarEvent{}
+			duration = 0
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if current == nil {
+				continue
+			}
+			if current.Start.IsZero() {
+				return nil, groupbyError("VEVENT without DTSTART ending on line " + strconv.Itoa(lineNo+1))
+			}
+			if current.End.IsZero() {
+				switch {
+				case duration > 0:
+					current.End = current.Start.Add(duration)
+				case current.AllDay:
+					current.End = current.Start.AddDate(0, 0, 1)
+				default:
+					current.End = current.Start
+				}
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			continue
+		case name == "SUMMARY":
+			current.Summary = unescapeICSText(value)
+		case name == "DTSTART":
+			tm, allDay, err := parseICSTime(params, value)
+			if err != nil {
+				return nil, groupbyError("Invalid DTSTART on line " + strconv.Itoa(lineNo+1) + ": " + value)
+			}
+			current.Start, current.AllDay = tm, allDay
+		case name == "DTEND":
+			tm, _, err := parseICSTime(params, value)
+			if err != nil {
+				return nil, groupbyError("Invalid DTEND on line " + strconv.Itoa(lineNo+1) + ": " + value)
+			}
+			current.End = tm
+		case name == "DURATION":
+			d, err := parseICSDuration(value)
+			if err != nil {
+				return nil, groupbyError("Invalid DURATION on line " + strconv.Itoa(lineNo+1) + ": " + value)
+			}
+			duration = d
+		}
+	}
+	return events, nil
+}
+
+// unfoldICSLines joins content lines that were folded over several physical
+// lines, which continue with a leading space or tab
+func unfoldICSLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// splitICSLine splits a content line such as
+// DTSTART;TZID=Europe/Berlin:20190601T180000 into its name, parameters and value
+func splitICSLine(line string) (string, map[string]string, string) {
+	params := map[string]string{}
+	colon := -1
+	quoted := false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return strings.ToUpper(line), params, ""
+	}
+	parts := strings.Split(line[:colon], ";")
+	for _, p := range parts[1:] {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], "\"")
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+func unescapeICSText(value string) string {
+	replacer := strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(value)
+}
+
+// parseICSTime parses a DATE or DATE-TIME value, returning whether it is a
+// date only (all-day) value
+func parseICSTime(params map[string]string, value string) (time.Time, bool, error) {
+	loc := location
+	if tzid, ok := params["TZID"]; ok {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		tm, err := time.ParseInLocation("20060102", value, location)
+		return tm, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		tm, err := time.Parse("20060102T150405Z", value)
+		return tm, false, err
+	}
+	tm, err := time.ParseInLocation("20060102T150405", value, loc)
+	return tm, false, err
+}
+
+var icsDurationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICSDuration parses a DURATION value such as P1D or PT1H30M
+func parseICSDuration(value string) (time.Duration, error) {
+	m := icsDurationPattern.FindStringSubmatch(value)
+	if m == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, groupbyError("Invalid duration " + value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// AddCalendarEvents adds the files taken during one of the events to a folder
+// named after the event, directly below the root of the tree. The files that
+// don't fall within any event are returned so they can be grouped as usual.
+func (t *Tree) AddCalendarEvents(files []os.FileInfo, events []CalendarEvent) []os.FileInfo {
+	var unmatched []os.FileInfo
+	for _, f := range files {
+		node := t.newFileNode(f)
+		event := FindCalendarEvent(events, node.Date)
+		if event == nil {
+			unmatched = append(unmatched, f)
+			continue
+		}
+		if !t.count(f) {
+			continue
+		}
+
+		name := event.FolderName()
+		eventNode := t.Root.Search(name)
+		if eventNode == nil {
+			eventNode = NewNode(name, event.Start.Year(), event.Start.Month(), event.Start.Day())
+			t.Root.AddChild(eventNode)
+		}
+		eventNode.AddChild(node)
+	}
+	return unmatched
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:GopherCon\\, Berlin\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20190601T090000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20190601T180000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Trip to the\r\n" +
+	"  lake\r\n" +
+	"DTSTART;VALUE=DATE:20190710\r\n" +
+	"DTEND;VALUE=DATE:20190712\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Call/Standup\r\n" +
+	"DTSTART:20190801T080000Z\r\n" +
+	"DURATION:PT30M\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICS(t *testing.T) {
+	events, err := ParseICS(strings.NewReader(testCalendar))
+	if err != nil {
+		t.Fatalf("ParseICS returned an error: %s", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("ParseICS returned %d events, Expected 3", len(events))
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("Time zone database is not available")
+	}
+
+	tests := []struct {
+		folder string
+		start  time.Time
+		end    time.Time
+		allDay bool
+	}{
+		{"GopherCon, Berlin", time.Date(2019, time.June, 1, 9, 0, 0, 0, berlin), time.Date(2019, time.June, 1, 18, 0, 0, 0, berlin), false},
+		{"Trip to the lake", time.Date(2019, time.July, 10, 0, 0, 0, 0, time.Local), time.Date(2019, time.July, 12, 0, 0, 0, 0, time.Local), true},
+		{"Call-Standup", time.Date(2019, time.August, 1, 8, 0, 0, 0, time.UTC), time.Date(2019, time.August, 1, 8, 30, 0, 0, time.UTC), false},
+	}
+
+	for i, test := range tests {
+		e := events[i]
+		if e.FolderName() != test.folder {
+			t.Errorf("Event folder name is incorrect. Got '%s', Expected '%s'", e.FolderName(), test.folder)
+		}
+		if !e.Start.Equal(test.start) || !e.End.Equal(test.end) || e.AllDay != test.allDay {
+			t.Errorf("Event '%s' is incorrect. Got (%s, %s, %t), Expected (%s, %s, %t)",
+				test.folder, e.Start, e.End, e.AllDay, test.start, test.end, test.allDay)
+		}
+	}
+}
+
+func TestAddCalendarEvents(t *testing.T) {
+	events := []CalendarEvent{
+		{Summary: "Trip", Start: time.Date(2019, time.July, 10, 0, 0, 0, 0, time.UTC), End: time.Date(2019, time.July, 12, 0, 0, 0, 0, time.UTC)},
+	}
+	fileMode := os.FileMode(0644)
+	files := []os.FileInfo{
+		fileInfo{"during.jpg", 1024, fileMode, time.Date(2019, time.July, 11, 23, 59, 0, 0, time.UTC)},
+		fileInfo{"after.jpg", 1024, fileMode, time.Date(2019, time.July, 12, 0, 0, 0, 0, time.UTC)},
+	}
+
+	tree := &Tree{
+		Root:     NewNode("/", 2019, time.July, 1),
+		MaxDepth: 3,
+	}
+	unmatched := tree.AddCalendarEvents(files, events)
+
+	eventNode := tree.Root.Search("Trip")
+	if eventNode == nil || eventNode.Search("during.jpg") == nil {
+		t.Errorf("File 'during.jpg' expected in event 'Trip', but not found.")
+	}
+	if len(unmatched) != 1 || unmatched[0].Name() != "after.jpg" {
+		t.Errorf("AddCalendarEvents should return 'after.jpg' as unmatched, got %v", unmatched)
+	}
+}
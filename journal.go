@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateDirName is the directory groupby keeps its journals in, inside the
+// output directory. It is never grouped.
+const stateDirName = ".groupby-state"
+
+const journalExtension = ".ndjson"
+
+// pendingExtension ends the names of the plans of the operations an
+// interrupted run didn't perform, saved next to its journal
+const pendingExtension = ".pending.json"
+
+// Journal records the operations performed by a run so they can be undone.
+// The journal file is only created once the first operation is recorded.
+type Journal struct {
+	Path      string
+	outputDir string
+	// mu serializes the operations recorded by parallel workers
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// JournalEntry is a performed operation, with absolute paths
+type JournalEntry struct {
+	Operation
+	Time time.Time `json:"time"`
+}
+
+// NewJournal returns the journal for a run grouping into outputDir
+func NewJournal(outputDir string) *Journal {
+	return &Journal{outputDir: outputDir}
+}
+
+// OpenJournal returns the journal at path of a run grouping into outputDir,
+// recording further operations at its end
+func OpenJournal(path, outputDir string) *Journal {
+	return &Journal{Path: path, outputDir: outputDir}
+}
+
+// journalDir returns the directory the journals of outputDir are kept in
+func journalDir(outputDir string) string {
+	return filepath.Join(outputDir, stateDirName, "journal")
+}
+
+// Record appends the performed operation to the journal
+func (j *Journal) Record(op *Operation) error {
+	if j == nil || op.Action == ActionSkip {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.open(); err != nil {
+		return err
+	}
+
+	entry := JournalEntry{Operation: *op, Time: time.Now()}
+	var err error
+	if entry.Source, err = filepath.Abs(op.Source); err != nil {
+		return err
+	}
+	if entry.Destination, err = filepath.Abs(op.Destination); err != nil {
+		return err
+	}
+	return j.encoder.Encode(entry)
+}
+
+// open creates the journal file, or opens it for appending if the journal
+// has a path already
+func (j *Journal) open() error {
+	if j.file != nil {
+		return nil
+	}
+	if j.Path != "" {
+		file, err := os.OpenFile(j.Path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		j.file, j.encoder = file, json.NewEncoder(file)
+		return nil
+	}
+
+	dir := journalDir(j.outputDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := time.Now().Format("20060102T150405.000000000") + journalExtension
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	j.Path, j.file, j.encoder = file.Name(), file, json.NewEncoder(file)
+	return nil
+}
+
+// Close writes the journal file to disk and closes it, if one was written
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	j.file.Sync()
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// pendingPath returns the path the operations left by the run of the journal
+// are saved at
+func pendingPath(journal string) string {
+	return strings.TrimSuffix(journal, journalExtension) + pendingExtension
+}
+
+// SavePending saves the operations the run didn't get to perform next to the
+// journal, as a plan resume performs. The journal file is created if nothing
+// was recorded yet.
+func (j *Journal) SavePending(ops []*Operation, perm os.FileMode) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.open(); err != nil {
+		return err
+	}
+	plan, err := NewPlanFile(j.outputDir, j.outputDir, ops)
+	if err != nil {
+		return err
+	}
+	plan.DirectoryMode = perm
+
+	file, err := os.Create(pendingPath(j.Path))
+	if err != nil {
+		return err
+	}
+	if err = WritePlanFile(file, plan); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LatestPending returns the path of the most recent journal of outputDir
+// whose run was interrupted before performing all its operations
+func LatestPending(outputDir string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(journalDir(outputDir), "*"+pendingExtension))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", groupbyError("No interrupted run found in " + journalDir(outputDir))
+	}
+	sort.Strings(matches)
+	return strings.TrimSuffix(matches[len(matches)-1], pendingExtension) + journalExtension, nil
+}
+
+// LatestJournal returns the path of the most recent journal of outputDir that
+// hasn't been undone
+func LatestJournal(outputDir string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(journalDir(outputDir), "*"+journalExtension))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", groupbyError("No journal found in " + journalDir(outputDir))
+	}
+	// Journal names start with the time they were created at
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+// ReadJournal reads the entries of a journal file
+func ReadJournal(filename string) ([]*JournalEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		entry := &JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// MarkUndone renames the journal so it is no longer picked by LatestJournal,
+// and forgets the operations its run left, if it was interrupted
+func MarkUndone(filename string) error {
+	if err := os.Remove(pendingPath(filename)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(filename, strings.TrimSuffix(filename, journalExtension)+".undone")
+}
+
+// Undo reverses the journal entries in reverse order: moved files are moved
+// back, links are removed, links removed by ungroup are made again and
+// duplicates replaced by links get a copy of their content back.
+// The manifests of the folders are updated and directories left empty are
+// removed up to outputDir. It returns the entries that couldn't be undone.
+func Undo(entries []*JournalEntry, outputDir string) map[*JournalEntry]error {
+	failed := map[*JournalEntry]error{}
+	root, _ := filepath.Abs(outputDir)
+	changes := newManifestChanges()
+	var dirs []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		var err error
+		switch entry.Action {
+		case ActionMove:
+			if _, statErr := os.Lstat(entry.Source); statErr == nil {
+				err = groupbyError("Cannot move back, " + entry.Source + " already exists")
+				break
+			}
+			if err = os.MkdirAll(filepath.Dir(entry.Source), 0755); err == nil {
+				_, err = moveFile(entry.Destination, entry.Source, false, "")
+			}
+		case ActionLink, ActionSymlink:
+			err = os.Remove(entry.Destination)
+		case ActionUnlink:
+			if err = os.MkdirAll(filepath.Dir(entry.Source), 0755); err != nil {
+				break
+			}
+			// Duplicates replaced by links to their original get their own
+			// copy back, directories were linked to with symlinks
+			stat, statErr := os.Stat(entry.Destination)
+			switch {
+			case entry.DuplicateOf != "":
+				_, err = copyFile(entry.Destination, entry.Source, false, "")
+			case statErr == nil && stat.IsDir():
+				err = os.Symlink(entry.Destination, entry.Source)
+			default:
+				err = os.Link(entry.Destination, entry.Source)
+			}
+		}
+		if err != nil {
+			failed[entry] = err
+			continue
+		}
+		if entry.Action != ActionUnlink {
+			changes.remove(entry.Destination)
+		}
+		// Files put back into folders with a manifest are listed in it again
+		if entry.Action == ActionMove || entry.Action == ActionUnlink {
+			if hasManifest(filepath.Dir(entry.Source)) {
+				changes.add(entry.Source, "")
+			}
+		}
+		dirs = append(dirs, filepath.Dir(entry.Destination))
+	}
+	if err := changes.apply(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+	for _, dir := range dirs {
+		removeEmptyDirs(dir, root)
+	}
+	return failed
+}
+
+// removeEmptyDirs removes dir and its parents as long as they are empty,
+// stopping at root. Either may be relative to the working directory.
+func removeEmptyDirs(dir, root string) {
+	dir, _ = filepath.Abs(dir)
+	root, _ = filepath.Abs(root)
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
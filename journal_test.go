@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalUndo(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ops := []*Operation{
+		{Source: filepath.Join(dir, "a.jpg"), Destination: filepath.Join(dir, "2019", "July", "a.jpg"), Action: ActionMove},
+		{Source: filepath.Join(dir, "b.jpg"), Destination: filepath.Join(dir, "2019", "June", "b.jpg"), Action: ActionLink},
+		{Source: filepath.Join(dir, "c.jpg"), Destination: filepath.Join(dir, "c.jpg"), Action: ActionSkip},
+	}
+
+	journal := NewJournal(dir)
+	for i, err := range NewExecutor(0755, journal).Execute(ops) {
+		if err != nil {
+			t.Fatalf("Executor.Execute returned an error for %s: %s", ops[i].Source, err)
+		}
+	}
+	journal.Close()
+	// The manifests of the folders are removed with their files
+	writeManifests = true
+	err := UpdateManifests(ops, make([]error, len(ops)))
+	writeManifests = false
+	if err != nil || !hasManifest(filepath.Join(dir, "2019", "July")) {
+		t.Fatalf("UpdateManifests did not write the manifest: %v", err)
+	}
+
+	filename, err := LatestJournal(dir)
+	if err != nil || filename != journal.Path {
+		t.Fatalf("LatestJournal is incorrect. Got '%s' (%v), Expected '%s'", filename, err, journal.Path)
+	}
+	entries, err := ReadJournal(filename)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("ReadJournal returned %d entries (%v), Expected 2", len(entries), err)
+	}
+
+	if failed := Undo(entries, dir); len(failed) != 0 {
+		t.Errorf("Undo failed for %d entries", len(failed))
+	}
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Undo did not restore %s: %s", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2019")); !os.IsNotExist(err) {
+		t.Errorf("Undo did not remove the emptied year directory")
+	}
+
+	if err := MarkUndone(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LatestJournal(dir); err == nil {
+		t.Errorf("LatestJournal should not return a journal that was undone")
+	}
+}
+
+func TestJournalPending(t *testing.T) {
+	dir := t.TempDir()
+	var ops []*Operation
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, &Operation{Source: filepath.Join(dir, name), Destination: filepath.Join(dir, "2019", name), Action: ActionMove})
+	}
+
+	if _, err := LatestPending(dir); err == nil {
+		t.Errorf("LatestPending should return an error when no run was interrupted")
+	}
+
+	// The run was interrupted after moving a.jpg
+	journal := NewJournal(dir)
+	if err := NewExecutor(0755, journal).Execute(ops[:1])[0]; err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.SavePending(ops[1:], 0700); err != nil {
+		t.Fatalf("Journal.SavePending returned an error: %s", err)
+	}
+	journal.Close()
+
+	filename, err := LatestPending(dir)
+	if err != nil || filename != journal.Path {
+		t.Fatalf("LatestPending is incorrect. Got '%s' (%v), Expected '%s'", filename, err, journal.Path)
+	}
+	in, err := os.Open(pendingPath(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := ReadPlanFile(in)
+	in.Close()
+	if err != nil || len(plan.Operations) != 2 || plan.DirectoryMode != 0700 {
+		t.Fatalf("Journal.SavePending saved an incorrect plan: %+v (%v)", plan, err)
+	}
+
+	// Resuming records in the same journal
+	resumed := OpenJournal(filename, dir)
+	resumed.Record(ops[1])
+	resumed.Close()
+	if entries, err := ReadJournal(filename); err != nil || len(entries) != 2 {
+		t.Errorf("OpenJournal should append to the journal. Got %d entries (%v), Expected 2", len(entries), err)
+	}
+
+	if err := MarkUndone(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LatestPending(dir); err == nil {
+		t.Errorf("LatestPending should not return a run that was undone")
+	}
+}
+
+func TestRemoveEmptyDirs(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join("2023", "March", "5"), 0755)
+	os.MkdirAll(filepath.Join("2023", "April"), 0755)
+
+	// Folders relative to the working directory are removed up to the root
+	removeEmptyDirs(filepath.Join("2023", "March", "5"), dir)
+	if _, err := os.Stat(filepath.Join(dir, "2023", "March")); !os.IsNotExist(err) {
+		t.Errorf("removeEmptyDirs did not remove the emptied month directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2023")); err != nil {
+		t.Errorf("removeEmptyDirs removed the year directory which isn't empty")
+	}
+	removeEmptyDirs(filepath.Join("2023", "April"), ".")
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("removeEmptyDirs removed the root: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2023")); !os.IsNotExist(err) {
+		t.Errorf("removeEmptyDirs did not remove the emptied year directory")
+	}
+}
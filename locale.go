@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Locale holds the month and weekday names used in folder names. Weekdays
+// start on Sunday, as time.Weekday does.
+type Locale struct {
+	Months        [12]string
+	ShortMonths   [12]string
+	Weekdays      [7]string
+	ShortWeekdays [7]string
+}
+
+var locales = map[string]*Locale{
+	"en": {
+		Months:        [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		ShortMonths:   [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		Weekdays:      [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		ShortWeekdays: [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	},
+	"de": {
+		Months:        [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		ShortMonths:   [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		Weekdays:      [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		ShortWeekdays: [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+	},
+	"fr": {
+		Months:        [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		ShortMonths:   [12]string{"janv", "févr", "mars", "avr", "mai", "juin", "juil", "août", "sept", "oct", "nov", "déc"},
+		Weekdays:      [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		ShortWeekdays: [7]string{"dim", "lun", "mar", "mer", "jeu", "ven", "sam"},
+	},
+	"es": {
+		Months:        [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		ShortMonths:   [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		Weekdays:      [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		ShortWeekdays: [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	},
+	"it": {
+		Months:        [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		ShortMonths:   [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		Weekdays:      [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		ShortWeekdays: [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	},
+	"pt": {
+		Months:        [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		ShortMonths:   [12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		Weekdays:      [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		ShortWeekdays: [7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+	},
+	"nl": {
+		Months:        [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		ShortMonths:   [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		Weekdays:      [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		ShortWeekdays: [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+	},
+}
+
+// currentLocale is the locale chosen with -locale or -locale-file
+var currentLocale = locales["en"]
+
+// Month returns the full name of the month
+func (l *Locale) Month(m time.Month) string {
+	return l.Months[m-1]
+}
+
+// ShortMonth returns the abbreviated name of the month
+func (l *Locale) ShortMonth(m time.Month) string {
+	return l.ShortMonths[m-1]
+}
+
+// Weekday returns the full name of the day of the week
+func (l *Locale) Weekday(d time.Weekday) string {
+	return l.Weekdays[d]
+}
+
+// ShortWeekday returns the abbreviated name of the day of the week
+func (l *Locale) ShortWeekday(d time.Weekday) string {
+	return l.ShortWeekdays[d]
+}
+
+// LocaleNames returns the names of the built-in locales
+func LocaleNames() []string {
+	return []string{"de", "en", "es", "fr", "it", "nl", "pt"}
+}
+
+// LookupLocale returns the built-in locale for a language such as "de", also
+// accepting the forms used by the LANG environment variable (de_DE.UTF-8)
+func LookupLocale(name string) (*Locale, error) {
+	language := strings.ToLower(name)
+	if i := strings.IndexAny(language, "_-."); i >= 0 {
+		language = language[:i]
+	}
+	if l, ok := locales[language]; ok {
+		return l, nil
+	}
+	return nil, groupbyError("Unknown locale '" + name + "', expected one of " + strings.Join(LocaleNames(), ", ") + " or a -locale-file")
+}
+
+// LoadLocaleFile reads a locale from a file of comma separated names, for
+// example:
+//
+//	months = Januar, Februar, März, ...
+//	short_months = Jan, Feb, Mär, ...
+//	weekdays = Sonntag, Montag, ...
+//	short_weekdays = So, Mo, ...
+//
+// Only months is required. Missing short names are made from the first three
+// letters of the full names and missing weekdays are taken from English.
+func LoadLocaleFile(filename string) (*Locale, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	l := &Locale{}
+	*l = *locales["en"]
+	found := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, groupbyError(filename + ":" + strconv.Itoa(lineNo) + ": expected key = names")
+		}
+		key := strings.TrimSpace(kv[0])
+		names := strings.Split(kv[1], ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+
+		var target []string
+		switch key {
+		case "months":
+			target = l.Months[:]
+		case "short_months":
+			target = l.ShortMonths[:]
+		case "weekdays":
+			target = l.Weekdays[:]
+		case "short_weekdays":
+			target = l.ShortWeekdays[:]
+		default:
+			return nil, groupbyError(filename + ":" + strconv.Itoa(lineNo) + ": unknown key '" + key + "'")
+		}
+		if len(names) != len(target) {
+			return nil, groupbyError(filename + ":" + strconv.Itoa(lineNo) + ": expected " + strconv.Itoa(len(target)) + " names for " + key)
+		}
+		copy(target, names)
+		found[key] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !found["months"] {
+		return nil, groupbyError(filename + ": months are missing")
+	}
+	if !found["short_months"] {
+		for i, name := range l.Months {
+			l.ShortMonths[i] = abbreviate(name)
+		}
+	}
+	if found["weekdays"] && !found["short_weekdays"] {
+		for i, name := range l.Weekdays {
+			l.ShortWeekdays[i] = abbreviate(name)
+		}
+	}
+	return l, nil
+}
+
+// abbreviate returns the first three letters of name
+func abbreviate(name string) string {
+	for i := range name {
+		if utf8.RuneCountInString(name[:i]) == 3 {
+			return name[:i]
+		}
+	}
+	return name
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLookupLocale(t *testing.T) {
+	tests := []struct {
+		name     string
+		month    string
+		weekday  string
+		expected bool
+	}{
+		{"de", "März", "Sonntag", true},
+		{"fr_FR.UTF-8", "mars", "dimanche", true},
+		{"EN", "March", "Sunday", true},
+		{"xx", "", "", false},
+	}
+
+	for _, test := range tests {
+		l, err := LookupLocale(test.name)
+		if (err == nil) != test.expected {
+			t.Errorf("LookupLocale(\"%s\") returned error '%v'", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if l.Month(time.March) != test.month || l.Weekday(time.Sunday) != test.weekday {
+			t.Errorf("LookupLocale(\"%s\") names are incorrect. Got '%s' '%s', Expected '%s' '%s'",
+				test.name, l.Month(time.March), l.Weekday(time.Sunday), test.month, test.weekday)
+		}
+	}
+}
+
+func TestMonthAsNameUsesLocale(t *testing.T) {
+	defer func() { currentLocale = locales["en"] }()
+
+	currentLocale = locales["de"]
+	if name := MonthAsName("12"); name != "Dezember" {
+		t.Errorf("MonthAsName(\"12\") with German locale is incorrect. Got '%s', Expected 'Dezember'", name)
+	}
+}
+
+func TestLoadLocaleFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sv.txt")
+	contents := "# Swedish\n" +
+		"months = januari, februari, mars, april, maj, juni, juli, augusti, september, oktober, november, december\n"
+	if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := LoadLocaleFile(filename)
+	if err != nil {
+		t.Fatalf("LoadLocaleFile returned an error: %s", err)
+	}
+	if l.Month(time.May) != "maj" || l.ShortMonth(time.August) != "aug" || l.Weekday(time.Monday) != "Monday" {
+		t.Errorf("LoadLocaleFile names are incorrect. Got '%s' '%s' '%s'", l.Month(time.May), l.ShortMonth(time.August), l.Weekday(time.Monday))
+	}
+
+	if err := os.WriteFile(filename, []byte("months = a, b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLocaleFile(filename); err == nil {
+		t.Errorf("LoadLocaleFile should fail when not all months are given")
+	}
+}
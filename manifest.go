@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifestName is the name of the checksum manifests written into the
+// folders files are grouped into, in the format of sha256sum
+const manifestName = "SHA256SUMS"
+
+// Manifest maps the paths of the files of a folder, relative to it, to their
+// SHA-256 checksums in hex
+type Manifest map[string]string
+
+// hasManifest returns true if the folder has a manifest
+func hasManifest(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, manifestName))
+	return err == nil
+}
+
+// ReadManifest reads the manifest of the folder, empty if it has none
+func ReadManifest(dir string) (Manifest, error) {
+	manifest := Manifest{}
+	file, err := os.Open(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		// sha256sum writes "HASH  NAME", or "HASH *NAME" in binary mode
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || len(fields[0]) != 64 || len(fields[1]) < 2 {
+			return nil, groupbyError(fmt.Sprintf("%s:%d: expected a checksum and a file name", filepath.Join(dir, manifestName), lineNo))
+		}
+		manifest[filepath.FromSlash(fields[1][1:])] = strings.ToLower(fields[0])
+	}
+	return manifest, scanner.Err()
+}
+
+// Write writes the manifest into the folder sorted by path, removing the
+// manifest file when it is empty
+func (m Manifest) Write(dir string) error {
+	path := filepath.Join(dir, manifestName)
+	if len(m) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	paths := make([]string, 0, len(m))
+	for p := range m {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", m[p], filepath.ToSlash(p))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// add adds the file or the files of the directory at path, named name in the
+// manifest, hashing them unless the checksum of the file is given. Symlinks,
+// such as the ones to directories grouped with -copy-only, aren't listed.
+func (m Manifest) add(path, name, checksum string) error {
+	if sum := strings.TrimPrefix(checksum, "sha256:"); sum != checksum {
+		m[name] = sum
+		return nil
+	}
+	return filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		sum, err := HashFile(file, HashSHA256)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(path, file)
+		m[filepath.Join(name, rel)] = strings.TrimPrefix(sum, "sha256:")
+		return nil
+	})
+}
+
+// remove removes the file or the files of the directory named name
+func (m Manifest) remove(name string) {
+	delete(m, name)
+	for p := range m {
+		if strings.HasPrefix(p, name+string(filepath.Separator)) {
+			delete(m, p)
+		}
+	}
+}
+
+// manifestChanges collects the files added to and removed from the
+// manifests of their folders, so each manifest is rewritten once
+type manifestChanges struct {
+	// added maps folders to the names of the files added and their
+	// checksums, if known
+	added   map[string]map[string]string
+	removed map[string][]string
+}
+
+func newManifestChanges() *manifestChanges {
+	return &manifestChanges{added: map[string]map[string]string{}, removed: map[string][]string{}}
+}
+
+// add records that the file or directory at path was added to its folder,
+// along with its checksum if it is known
+func (c *manifestChanges) add(path, checksum string) {
+	dir := filepath.Dir(path)
+	if c.added[dir] == nil {
+		c.added[dir] = map[string]string{}
+	}
+	c.added[dir][filepath.Base(path)] = checksum
+}
+
+// remove records that the file or directory at path left its folder
+func (c *manifestChanges) remove(path string) {
+	dir := filepath.Dir(path)
+	c.removed[dir] = append(c.removed[dir], filepath.Base(path))
+}
+
+// apply updates the manifests of the folders, creating them for the folders
+// files were added to. Folders without a manifest that only lost files are
+// left alone. Files that can't be hashed are left out, and folders whose
+// manifest can't be updated don't keep the others from being updated.
+func (c *manifestChanges) apply() error {
+	dirs := map[string]bool{}
+	for dir := range c.added {
+		dirs[dir] = true
+	}
+	for dir := range c.removed {
+		if hasManifest(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	var failed []string
+	for dir := range dirs {
+		manifest, err := ReadManifest(dir)
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		for _, name := range c.removed[dir] {
+			manifest.remove(name)
+		}
+		for name, checksum := range c.added[dir] {
+			if err := manifest.add(filepath.Join(dir, name), name, checksum); err != nil {
+				failed = append(failed, err.Error())
+			}
+		}
+		if err := manifest.Write(dir); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return groupbyError("Failed to update manifests: " + strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// UpdateManifests updates the manifests of the folders the operations that
+// succeeded moved files out of and, with -manifest, of the folders they
+// grouped files into
+func UpdateManifests(ops []*Operation, errs []error) error {
+	changes := newManifestChanges()
+	for i, op := range ops {
+		if errs[i] != nil || op.Action == ActionSkip {
+			continue
+		}
+		if op.Action == ActionMove || op.Action == ActionUnlink {
+			changes.remove(op.Source)
+		}
+		if writeManifests && op.Action != ActionUnlink {
+			changes.add(op.Destination, op.Checksum)
+		}
+	}
+	return changes.apply()
+}
+
+// Kinds of problems VerifyManifests finds
+const (
+	ManifestMissing   = "missing"
+	ManifestCorrupted = "corrupted"
+	ManifestExtra     = "extra"
+)
+
+// ManifestProblem is a file that doesn't match the manifest of its folder
+type ManifestProblem struct {
+	Path string
+	Kind string
+}
+
+// ManifestReport is what VerifyManifests found
+type ManifestReport struct {
+	Manifests int
+	Files     int
+	Problems  []ManifestProblem
+}
+
+// VerifyManifests checks the files of the folders under root that have a
+// manifest against it: files listed but gone are missing, files whose
+// checksum differs are corrupted and files not listed are extra. Folders
+// with a manifest of their own are checked against it. The paths of the
+// problems are relative to root.
+func VerifyManifests(root string) (*ManifestReport, error) {
+	report := &ManifestReport{}
+	err := filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == stateDirName {
+			return filepath.SkipDir
+		}
+		if !hasManifest(dir) {
+			return nil
+		}
+		return verifyManifest(root, dir, report)
+	})
+	return report, err
+}
+
+func verifyManifest(root, dir string, report *ManifestReport) error {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+	report.Manifests++
+	problem := func(name, kind string) {
+		path, _ := filepath.Rel(root, filepath.Join(dir, name))
+		report.Problems = append(report.Problems, ManifestProblem{Path: path, Kind: kind})
+	}
+
+	names := make([]string, 0, len(manifest))
+	for name := range manifest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		report.Files++
+		sum, err := HashFile(filepath.Join(dir, name), HashSHA256)
+		switch {
+		case os.IsNotExist(err):
+			problem(name, ManifestMissing)
+		case err != nil:
+			return err
+		case strings.TrimPrefix(sum, "sha256:") != manifest[name]:
+			problem(name, ManifestCorrupted)
+		}
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == dir {
+				return nil
+			}
+			// Folders with a manifest are checked against their own
+			if hasManifest(path) || info.Name() == stateDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		name, _ := filepath.Rel(dir, path)
+		if _, ok := manifest[name]; !ok && name != manifestName {
+			problem(name, ManifestExtra)
+		}
+		return nil
+	})
+}
+
+// writeManifestReport writes the problems of the report, one per line
+func writeManifestReport(w io.Writer, report *ManifestReport) {
+	for _, p := range report.Problems {
+		fmt.Fprintf(w, "%s: %s\n", filepath.ToSlash(p.Path), p.Kind)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	sumA = "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"
+	sumB = "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d"
+)
+
+func TestManifestReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	manifest := Manifest{"b.txt": sumB, filepath.Join("dir", "a.txt"): sumA}
+	if err := manifest.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, manifestName))
+	expected := sumB + "  b.txt\n" + sumA + "  dir/a.txt\n"
+	if string(content) != expected {
+		t.Errorf("Manifest.Write is incorrect. Got '%s', Expected '%s'", content, expected)
+	}
+
+	// Binary mode lines of sha256sum are read too
+	os.WriteFile(filepath.Join(dir, manifestName), []byte(expected+sumA+" *c.txt\n"), 0644)
+	read, err := ReadManifest(dir)
+	manifest["c.txt"] = sumA
+	if err != nil || !reflect.DeepEqual(read, manifest) {
+		t.Errorf("ReadManifest is incorrect. Got '%v' (%v), Expected '%v'", read, err, manifest)
+	}
+
+	os.WriteFile(filepath.Join(dir, manifestName), []byte("not a checksum\n"), 0644)
+	if _, err := ReadManifest(dir); err == nil {
+		t.Errorf("ReadManifest of an invalid line should return an error")
+	}
+
+	if err := (Manifest{}).Write(dir); err != nil || hasManifest(dir) {
+		t.Errorf("Writing an empty manifest should remove it. Got %v", err)
+	}
+}
+
+func TestUpdateManifests(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "2019", "July")
+	os.MkdirAll(old, 0755)
+	os.WriteFile(filepath.Join(old, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(old, "b.txt"), []byte("b"), 0644)
+	Manifest{"a.txt": sumA, "b.txt": sumB}.Write(old)
+	os.MkdirAll(filepath.Join(dir, "2019", "dir"), 0755)
+	os.WriteFile(filepath.Join(dir, "2019", "dir", "a.txt"), []byte("a"), 0644)
+
+	writeManifests = true
+	defer func() { writeManifests = false }()
+	ops := []*Operation{
+		{Source: filepath.Join(old, "a.txt"), Destination: filepath.Join(dir, "2019", "a.txt"), Action: ActionMove},
+		{Source: filepath.Join(old, "b.txt"), Destination: filepath.Join(dir, "2019", "b.txt"), Action: ActionMove, Checksum: "sha256:" + sumB},
+		{Source: filepath.Join(dir, "dir"), Destination: filepath.Join(dir, "2019", "dir"), Action: ActionMove},
+		{Source: filepath.Join(dir, "c.txt"), Destination: filepath.Join(dir, "2019", "c.txt"), Action: ActionMove},
+	}
+	os.Rename(ops[0].Source, ops[0].Destination)
+	// The checksum recorded by -verify is used as is
+	os.Rename(ops[1].Source, ops[1].Destination)
+	errs := []error{nil, nil, nil, os.ErrNotExist}
+
+	if err := UpdateManifests(ops, errs); err != nil {
+		t.Fatal(err)
+	}
+	if hasManifest(old) {
+		t.Errorf("UpdateManifests should remove the manifest of a folder left empty")
+	}
+	expected := Manifest{"a.txt": sumA, "b.txt": sumB, filepath.Join("dir", "a.txt"): sumA}
+	if got, err := ReadManifest(filepath.Join(dir, "2019")); err != nil || !reflect.DeepEqual(got, expected) {
+		t.Errorf("UpdateManifests is incorrect. Got '%v' (%v), Expected '%v'", got, err, expected)
+	}
+}
+
+func TestUpdateManifestsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644)
+
+	writeManifests = true
+	defer func() { writeManifests = false }()
+	// Directories grouped with -copy-only are symlinks, and gone.txt can't be
+	// hashed, which leaves the other files and folders alone
+	ops := []*Operation{
+		{Source: filepath.Join(dir, "sub"), Destination: filepath.Join(dir, "2026", "sub"), Action: ActionSymlink},
+		{Source: filepath.Join(dir, "a.txt"), Destination: filepath.Join(dir, "2026", "a.txt"), Action: ActionLink},
+		{Source: filepath.Join(dir, "gone.txt"), Destination: filepath.Join(dir, "2026", "gone.txt"), Action: ActionLink},
+		{Source: filepath.Join(dir, "b.txt"), Destination: filepath.Join(dir, "2027", "b.txt"), Action: ActionLink},
+	}
+	for _, op := range ops[:2] {
+		os.MkdirAll(filepath.Dir(op.Destination), 0755)
+		if err := performOperation(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.MkdirAll(filepath.Join(dir, "2027"), 0755)
+	performOperation(ops[3])
+
+	if err := UpdateManifests(ops, make([]error, len(ops))); err == nil {
+		t.Errorf("UpdateManifests should return an error for a file that can't be hashed")
+	}
+	expected := map[string]Manifest{"2026": {"a.txt": sumA}, "2027": {"b.txt": sumB}}
+	for folder, manifest := range expected {
+		if got, err := ReadManifest(filepath.Join(dir, folder)); err != nil || !reflect.DeepEqual(got, manifest) {
+			t.Errorf("UpdateManifests of %s is incorrect. Got '%v' (%v), Expected '%v'", folder, got, err, manifest)
+		}
+	}
+
+	report, err := VerifyManifests(filepath.Join(dir, "2026"))
+	if err != nil || len(report.Problems) != 0 {
+		t.Errorf("VerifyManifests with a symlink is incorrect. Got %v (%v), Expected no problems", report.Problems, err)
+	}
+}
+
+func TestVerifyManifests(t *testing.T) {
+	dir := t.TempDir()
+	folder := filepath.Join(dir, "2019")
+	os.MkdirAll(filepath.Join(folder, "July"), 0755)
+	os.WriteFile(filepath.Join(folder, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(folder, "b.txt"), []byte("corrupted"), 0644)
+	os.WriteFile(filepath.Join(folder, "extra.txt"), []byte("extra"), 0644)
+	Manifest{"a.txt": sumA, "b.txt": sumB, "missing.txt": sumA}.Write(folder)
+	// Folders with their own manifest are checked against it
+	os.WriteFile(filepath.Join(folder, "July", "a.txt"), []byte("a"), 0644)
+	Manifest{"a.txt": sumA}.Write(filepath.Join(folder, "July"))
+
+	report, err := VerifyManifests(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ManifestReport{
+		Manifests: 2,
+		Files:     4,
+		Problems: []ManifestProblem{
+			{filepath.Join("2019", "b.txt"), ManifestCorrupted},
+			{filepath.Join("2019", "missing.txt"), ManifestMissing},
+			{filepath.Join("2019", "extra.txt"), ManifestExtra},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("VerifyManifests is incorrect. Got '%+v', Expected '%+v'", report, expected)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Formats of month folder names made of the tokens 1 (month number), 01
+// (zero-padded month number), January (month name) and Jan (short month name)
+var monthFormats = []string{"1", "01", "January", "Jan", "01-January", "01 January", "01-Jan", "01 Jan"}
+
+// Formats of day folder names made of the tokens 2 (day of the month), 02
+// (zero-padded day), Monday (weekday name) and Mon (short weekday name)
+var dayFormats = []string{"2", "02", "02 Monday", "02 Mon", "02-Monday", "02-Mon"}
+
+// ValidateMonthFormat returns an error if format has no month token in it
+func ValidateMonthFormat(format string) error {
+	if strings.ContainsAny(format, `/\`) || !strings.Contains(format, "1") && !strings.Contains(format, "Jan") {
+		return groupbyError("Invalid month format '" + format + "', expected one of " + strings.Join(monthFormats, ", "))
+	}
+	return nil
+}
+
+// ValidateDayFormat returns an error if format has no day token in it
+func ValidateDayFormat(format string) error {
+	if strings.ContainsAny(format, `/\`) || !strings.Contains(format, "2") {
+		return groupbyError("Invalid day format '" + format + "', expected one of " + strings.Join(dayFormats, ", "))
+	}
+	return nil
+}
+
+// FormatMonth returns the name of the month folder for m according to format,
+// e.g. "01 Jan" for January
+func FormatMonth(format string, m time.Month) string {
+	return strings.NewReplacer(
+		"January", currentLocale.Month(m),
+		"Jan", currentLocale.ShortMonth(m),
+		"01", fmt.Sprintf("%02d", int(m)),
+		"1", fmt.Sprintf("%d", int(m)),
+	).Replace(format)
+}
+
+// FormatDay returns the name of the day folder for date according to format,
+// e.g. "05 Fri" for Friday the 5th
+func FormatDay(format string, date time.Time) string {
+	return strings.NewReplacer(
+		"Monday", currentLocale.Weekday(date.Weekday()),
+		"Mon", currentLocale.ShortWeekday(date.Weekday()),
+		"02", fmt.Sprintf("%02d", date.Day()),
+		"2", fmt.Sprintf("%d", date.Day()),
+	).Replace(format)
+}
+
+// monthNameFormat returns the format of month folder names, which is the
+// month name unless -expand-month=false or -month-format were given
+func monthNameFormat() string {
+	if monthFormat != "" {
+		return monthFormat
+	}
+	if expandMonth {
+		return "January"
+	}
+	return ""
+}
+
+// NodeName returns the name the node is given in the grouped tree. The
+// month and day folders are named according to -month-format and
+// -day-format, everything else keeps its name.
+func NodeName(n *Node, depth int) string {
+	// The leaves are the files being grouped
+	if !n.HasChildren() {
+		return n.FileName
+	}
+
+	switch depth {
+	case 2:
+		return FileNameByDepth(n.FileName, depth)
+	case 3:
+		if dayFormat == "" {
+			return n.FileName
+		}
+		return FormatDay(dayFormat, time.Date(n.Year, n.Month, n.Day, 0, 0, 0, 0, time.UTC))
+	}
+	return n.FileName
+}
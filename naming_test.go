@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatMonth(t *testing.T) {
+	tests := []struct {
+		format   string
+		month    time.Month
+		expected string
+	}{
+		{"1", time.March, "3"},
+		{"01", time.March, "03"},
+		{"January", time.March, "March"},
+		{"Jan", time.March, "Mar"},
+		{"01-January", time.November, "11-November"},
+		{"01 Jan", time.January, "01 Jan"},
+	}
+
+	for _, test := range tests {
+		if result := FormatMonth(test.format, test.month); result != test.expected {
+			t.Errorf("FormatMonth(\"%s\", %s) is incorrect. Got '%s', Expected '%s'", test.format, test.month, result, test.expected)
+		}
+	}
+}
+
+func TestFormatDay(t *testing.T) {
+	date := time.Date(2019, time.July, 5, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"2", "5"},
+		{"02", "05"},
+		{"02 Mon", "05 Fri"},
+		{"02-Monday", "05-Friday"},
+	}
+
+	for _, test := range tests {
+		if result := FormatDay(test.format, date); result != test.expected {
+			t.Errorf("FormatDay(\"%s\") is incorrect. Got '%s', Expected '%s'", test.format, result, test.expected)
+		}
+	}
+}
+
+func TestValidateFormats(t *testing.T) {
+	for _, format := range monthFormats {
+		if err := ValidateMonthFormat(format); err != nil {
+			t.Errorf("ValidateMonthFormat(\"%s\") returned an error: %s", format, err)
+		}
+	}
+	for _, format := range dayFormats {
+		if err := ValidateDayFormat(format); err != nil {
+			t.Errorf("ValidateDayFormat(\"%s\") returned an error: %s", format, err)
+		}
+	}
+	for _, format := range []string{"MM", "01/Jan", ""} {
+		if ValidateMonthFormat(format) == nil {
+			t.Errorf("ValidateMonthFormat(\"%s\") should fail", format)
+		}
+	}
+}
+
+func TestNodeName(t *testing.T) {
+	defer func() { monthFormat, dayFormat, expandMonth = "", "", true }()
+	monthFormat, dayFormat = "01", "02 Mon"
+
+	yearNode := NewNode("2019", 2019, time.July, 5)
+	monthNode := NewNode("7", 2019, time.July, 5)
+	dayNode := NewNode("5", 2019, time.July, 5)
+	file := NewNode("3", 2019, time.July, 5)
+	yearNode.AddChild(monthNode)
+	monthNode.AddChild(dayNode)
+	dayNode.AddChild(file)
+
+	tests := []struct {
+		n        *Node
+		depth    int
+		expected string
+	}{
+		{yearNode, 1, "2019"},
+		{monthNode, 2, "07"},
+		{dayNode, 3, "05 Fri"},
+		{file, 2, "3"},
+	}
+
+	for _, test := range tests {
+		if result := NodeName(test.n, test.depth); result != test.expected {
+			t.Errorf("NodeName(\"%s\", %d) is incorrect. Got '%s', Expected '%s'", test.n.FileName, test.depth, result, test.expected)
+		}
+	}
+}
@@ -9,6 +9,19 @@ type Node struct {
 	Day      int
 	Next     *Node
 	Children *Node
+	// Date and DateSource are the date files are grouped by and where it was
+	// read from, they are not set on the folder nodes
+	Date       time.Time
+	DateSource string
+	// Source is the path of the file when it isn't in the root directory,
+	// such as a file being regrouped
+	Source string
+	// DuplicateOf is the name of the file this file is a duplicate of, with
+	// -duplicates
+	DuplicateOf string
+	// Companions are the files grouped along with this file, such as its
+	// RAW file or .xmp sidecar, see -sidecars
+	Companions []*Node
 }
 
 func NewNode(fileName string, year int, month time.Month, day int) *Node {
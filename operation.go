@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Actions taken on a file or directory being grouped
+const (
+	ActionMove    = "move"
+	ActionLink    = "link"
+	ActionSymlink = "symlink"
+	ActionSkip    = "skip"
+	// ActionUnlink removes the source, a link to the destination made
+	// when grouping with -copy-only
+	ActionUnlink = "unlink"
+)
+
+// Policies for when a different file already exists at the destination
+const (
+	ConflictSkip      = "skip"
+	ConflictRename    = "rename"
+	ConflictOverwrite = "overwrite"
+)
+
+var conflictPolicies = []string{ConflictSkip, ConflictRename, ConflictOverwrite}
+
+// ValidateConflictPolicy returns an error if policy is not one of the
+// conflict policies
+func ValidateConflictPolicy(policy string) error {
+	for _, p := range conflictPolicies {
+		if policy == p {
+			return nil
+		}
+	}
+	return groupbyError("Unknown conflict policy '" + policy + "', expected one of " + strings.Join(conflictPolicies, ", "))
+}
+
+// Operation describes what happens to a single file or directory when the
+// tree is grouped
+type Operation struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Date        time.Time `json:"date"`
+	DateSource  string    `json:"date_source"`
+	Action      string    `json:"action"`
+	// Conflict is set when a different file already exists at the
+	// destination, Overwrite when it is replaced according to -on-conflict
+	Conflict  bool `json:"conflict,omitempty"`
+	Overwrite bool `json:"overwrite,omitempty"`
+	// Checksum is the checksum of the file when it was copied with -verify
+	Checksum string `json:"checksum,omitempty"`
+	// DuplicateOf is the source of the file the file has the same content
+	// as, with -duplicates
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Primary is the source of the file this file is a companion of, with
+	// which it is grouped as a unit
+	Primary string `json:"primary,omitempty"`
+}
+
+// destinationBuilder keeps track of the folders leading to the node being
+// visited to work out where its file is grouped into. It is shared by the
+// visitors that group files and the ones that only describe what would happen.
+type destinationBuilder struct {
+	rootDir   string
+	outputDir string
+	flatten   bool
+	// copyOnly links files instead of moving them, like -copy-only
+	copyOnly  bool
+	pathParts []string
+	// planned holds the destinations of the operations returned so far, so
+	// two files are never given the same destination
+	planned map[string]bool
+}
+
+func newDestinationBuilder(rootDir, outputDir string, flatten bool) *destinationBuilder {
+	return &destinationBuilder{
+		rootDir:   rootDir,
+		outputDir: outputDir,
+		flatten:   flatten,
+		copyOnly:  copyOnly,
+		planned:   map[string]bool{},
+	}
+}
+
+// Operation returns the operation for the node at depth, or nil for the nodes
+// that are the folders files are grouped into. Nodes must be passed in the
+// order the tree is visited.
+func (b *destinationBuilder) Operation(n *Node, depth int) *Operation {
+	if depth == 0 {
+		b.pathParts = b.pathParts[:0]
+		return nil
+	}
+
+	// Deeper levels belong to previously visited nodes, e.g. a day folder
+	// visited before a calendar event folder on the first level
+	if len(b.pathParts) >= depth {
+		b.pathParts = b.pathParts[:depth-1]
+	}
+	for len(b.pathParts) < depth-1 {
+		b.pathParts = append(b.pathParts, "")
+	}
+	b.pathParts = append(b.pathParts, NodeName(n, depth))
+
+	// Only the leaves of the tree are files, the other nodes are folders
+	// which get created along with their files
+	if n.HasChildren() {
+		return nil
+	}
+
+	source := path.Join(b.rootDir, n.FileName)
+	if n.Source != "" {
+		source = n.Source
+	}
+	sfi, err := os.Stat(source)
+	if err != nil {
+		// some internal nodes in our tree won't exist
+		return nil
+	}
+
+	parents := b.pathParts[:depth-1]
+	destParts := []string{b.outputDir}
+	if b.flatten {
+		destParts = append(destParts, strings.Join(parents, "-"))
+	} else {
+		destParts = append(destParts, parents...)
+	}
+	destParts = append(destParts, n.FileName)
+
+	op := &Operation{
+		Source:      source,
+		Destination: path.Join(destParts...),
+		Date:        n.Date,
+		DateSource:  n.DateSource,
+		Action:      ActionMove,
+	}
+	if n.DuplicateOf != "" {
+		op.DuplicateOf = path.Join(b.rootDir, n.DuplicateOf)
+	}
+
+	switch {
+	case ignoreDirectories && sfi.IsDir():
+		op.Action = ActionSkip
+	case b.copyOnly && sfi.IsDir():
+		// Directories can't be hard linked, so they are linked to by absolute path
+		op.Action = ActionSymlink
+		op.Source, _ = filepath.Abs(op.Source)
+		op.Destination, _ = filepath.Abs(op.Destination)
+	case b.copyOnly:
+		op.Action = ActionLink
+	}
+
+	if dfi, err := os.Stat(op.Destination); err == nil && os.SameFile(sfi, dfi) {
+		op.Action = ActionSkip
+		return op
+	}
+
+	b.resolveConflict(op)
+	return op
+}
+
+// Operations returns the operations for the node at depth: the one of its
+// file followed by the ones of its companions, which go into the same folder
+// and are renamed along with it. Nil for the nodes that are folders.
+func (b *destinationBuilder) Operations(n *Node, depth int) []*Operation {
+	op := b.Operation(n, depth)
+	if op == nil {
+		return nil
+	}
+	ops := []*Operation{op}
+	for _, c := range n.Companions {
+		source := path.Join(b.rootDir, c.FileName)
+		if c.Source != "" {
+			source = c.Source
+		}
+		action := ActionMove
+		if b.copyOnly {
+			action = ActionLink
+		}
+		ops = append(ops, &Operation{
+			Source:     source,
+			Date:       c.Date,
+			DateSource: c.DateSource,
+			Action:     action,
+			Primary:    op.Source,
+		})
+	}
+	if len(ops) > 1 {
+		b.resolveUnitConflicts(n, ops)
+	}
+	return ops
+}
+
+// resolveUnitConflicts gives the companions of the operation of n, ops[0],
+// their destinations next to its destination, and applies -on-conflict to
+// them as a unit: when the destination of a companion is taken, the whole
+// unit is skipped or renamed to a number free for all of them, or the
+// companion overwrites it.
+func (b *destinationBuilder) resolveUnitConflicts(n *Node, ops []*Operation) {
+	primary := ops[0]
+	placeCompanions(n, ops, primary.Destination)
+	if primary.Action == ActionSkip && primary.Conflict {
+		for _, op := range ops[1:] {
+			op.Action, op.Conflict = ActionSkip, true
+		}
+		return
+	}
+
+	conflict := false
+	for _, op := range ops[1:] {
+		sfi, serr := os.Stat(op.Source)
+		dfi, derr := os.Stat(op.Destination)
+		switch {
+		case serr == nil && derr == nil && os.SameFile(sfi, dfi):
+			op.Action = ActionSkip
+		case b.exists(op.Destination):
+			op.Conflict, conflict = true, true
+		}
+	}
+
+	switch {
+	case !conflict:
+	case conflictPolicy == ConflictOverwrite:
+		for _, op := range ops[1:] {
+			op.Overwrite = op.Conflict
+		}
+	case conflictPolicy == ConflictRename && primary.Action != ActionSkip:
+		delete(b.planned, primary.Destination)
+		original := path.Join(path.Dir(primary.Destination), n.FileName)
+		for i := 1; ; i++ {
+			dest := numberedName(original, i)
+			placeCompanions(n, ops, dest)
+			if !b.unitTaken(dest, ops[1:]) {
+				primary.Destination, primary.Conflict = dest, true
+				break
+			}
+		}
+		b.planned[primary.Destination] = true
+	default:
+		for _, op := range ops {
+			op.Action, op.Conflict = ActionSkip, true
+		}
+	}
+	for _, op := range ops[1:] {
+		b.planned[op.Destination] = true
+	}
+}
+
+// placeCompanions gives the companions of the operation of n their
+// destinations next to dest, the destination of the operation
+func placeCompanions(n *Node, ops []*Operation, dest string) {
+	for i, op := range ops[1:] {
+		op.Destination = path.Join(path.Dir(dest), companionName(n.Companions[i].FileName, n.FileName, path.Base(dest)))
+	}
+}
+
+// unitTaken returns true if dest or the destination of a companion that
+// isn't skipped is taken
+func (b *destinationBuilder) unitTaken(dest string, companions []*Operation) bool {
+	if b.exists(dest) {
+		return true
+	}
+	for _, op := range companions {
+		if op.Action != ActionSkip && b.exists(op.Destination) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConflict applies -on-conflict when a different file already exists
+// at the destination of the operation or another operation was given it
+func (b *destinationBuilder) resolveConflict(op *Operation) {
+	if op.Action != ActionSkip && b.exists(op.Destination) {
+		op.Conflict = true
+		switch conflictPolicy {
+		case ConflictRename:
+			op.Destination = b.freeName(op.Destination)
+		case ConflictOverwrite:
+			op.Overwrite = true
+		default:
+			op.Action = ActionSkip
+		}
+	}
+	b.planned[op.Destination] = true
+}
+
+// exists returns true if there is a file at dest or another operation was
+// given dest
+func (b *destinationBuilder) exists(dest string) bool {
+	if b.planned[dest] {
+		return true
+	}
+	_, err := os.Lstat(dest)
+	return err == nil
+}
+
+// freeName returns dest with the lowest number that makes it unique added
+// before its extension, e.g. "photo (1).jpg"
+func (b *destinationBuilder) freeName(dest string) string {
+	for i := 1; ; i++ {
+		if candidate := numberedName(dest, i); !b.exists(candidate) {
+			return candidate
+		}
+	}
+}
+
+// numberedName returns dest with the number i added before its extension
+func numberedName(dest string, i int) string {
+	ext := path.Ext(dest)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(dest, ext), i, ext)
+}
+
+// Adapted from: https://stackoverflow.com/a/21067803
+// performOperation moves, hard links or symlinks the source of the operation
+// to its destination according to its action. The destination directory must
+// already exist. Files that can't be moved or linked to another file system
+// are copied, and with -verify the copies are checked against the source.
+func performOperation(op *Operation) error {
+	if verbose && op.Action != ActionSkip {
+		fmt.Println("Moving from=", op.Source, " to=", op.Destination)
+	}
+
+	if op.Overwrite && op.Action != ActionMove {
+		// Renaming replaces the destination, creating links doesn't
+		if err := os.Remove(op.Destination); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	algorithm := ""
+	if verifyCopies {
+		algorithm = hashAlgorithm
+	}
+
+	var err error
+	switch op.Action {
+	case ActionSkip:
+		return nil
+	case ActionMove:
+		op.Checksum, err = moveFile(op.Source, op.Destination, op.Overwrite, algorithm)
+		return err
+	case ActionLink:
+		// Creates a hardlink to the source, or a copy on another file system
+		if err = os.Link(op.Source, op.Destination); isCrossDevice(err) {
+			op.Checksum, err = copyFile(op.Source, op.Destination, op.Overwrite, algorithm)
+		}
+		return err
+	case ActionSymlink:
+		return os.Symlink(op.Source, op.Destination)
+	case ActionUnlink:
+		return os.Remove(op.Source)
+	}
+	return groupbyError("Unknown action " + op.Action)
+}
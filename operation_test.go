@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlanVisitorDestinations(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	date := time.Date(2019, time.July, 5, 12, 0, 0, 0, time.UTC)
+
+	// A day hierarchy visited before a calendar event folder
+	tree := &Tree{Root: NewNode(dir, 2019, time.July, 5), MaxDepth: 3}
+	yearNode := NewNode("2019", 2019, time.July, 5)
+	monthNode := NewNode("7", 2019, time.July, 5)
+	dayNode := NewNode("5", 2019, time.July, 5)
+	eventNode := NewNode("Lake trip", 2019, time.July, 10)
+	tree.Root.AddChild(eventNode)
+	tree.Root.AddChild(yearNode)
+	yearNode.AddChild(monthNode)
+	monthNode.AddChild(dayNode)
+	dayNode.AddChild(&Node{FileName: "a.jpg", Date: date, DateSource: DateSourceModified})
+	eventNode.AddChild(&Node{FileName: "b.jpg", Date: date, DateSource: DateSourceModified})
+	eventNode.AddChild(&Node{FileName: "missing.jpg", Date: date, DateSource: DateSourceModified})
+
+	tests := []struct {
+		flatten  bool
+		expected map[string]string
+	}{
+		{false, map[string]string{
+			"a.jpg": filepath.Join("out", "2019", "July", "5", "a.jpg"),
+			"b.jpg": filepath.Join("out", "Lake trip", "b.jpg"),
+		}},
+		{true, map[string]string{
+			"a.jpg": filepath.Join("out", "2019-July-5", "a.jpg"),
+			"b.jpg": filepath.Join("out", "Lake trip", "b.jpg"),
+		}},
+	}
+
+	for _, test := range tests {
+		visitor := NewPlanVisitor(dir, "out", test.flatten)
+		tree.Visit(visitor)
+		if len(visitor.Operations) != len(test.expected) {
+			t.Errorf("PlanVisitor with flatten=%t planned %d operations, Expected %d", test.flatten, len(visitor.Operations), len(test.expected))
+		}
+		for _, op := range visitor.Operations {
+			expected := test.expected[filepath.Base(op.Source)]
+			if op.Destination != expected || op.Action != ActionMove || !op.Date.Equal(date) {
+				t.Errorf("PlanVisitor with flatten=%t operation is incorrect. Got (%s, %s, %s), Expected (%s, %s, %s)",
+					test.flatten, op.Destination, op.Action, op.Date, expected, ActionMove, date)
+			}
+		}
+	}
+}
+
+func TestExecutorActions(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(source, []byte("photo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		action      string
+		destination string
+		sourceKept  bool
+	}{
+		{ActionLink, filepath.Join(dir, "linked", "a.jpg"), true},
+		{ActionSkip, filepath.Join(dir, "skipped", "a.jpg"), true},
+		{ActionMove, filepath.Join(dir, "moved", "a.jpg"), false},
+	}
+
+	for _, test := range tests {
+		op := &Operation{Source: source, Destination: test.destination, Action: test.action}
+		if err := NewExecutor(0755, nil).Execute([]*Operation{op})[0]; err != nil {
+			t.Errorf("Executor.Execute(%s) returned an error: %s", test.action, err)
+		}
+		_, err := os.Stat(test.destination)
+		if (err == nil) != (test.action != ActionSkip) {
+			t.Errorf("Executor.Execute(%s) destination existence is incorrect: %v", test.action, err)
+		}
+		if _, err := os.Stat(source); (err == nil) != test.sourceKept {
+			t.Errorf("Executor.Execute(%s) source existence is incorrect: %v", test.action, err)
+		}
+	}
+}
+
+func TestConflictPolicy(t *testing.T) {
+	defer func() { conflictPolicy = ConflictSkip }()
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	for _, name := range []string{"a.jpg", filepath.Join("out", "a.jpg"), filepath.Join("out", "a (1).jpg")} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		policy      string
+		destination string
+		action      string
+		overwrite   bool
+	}{
+		{ConflictSkip, filepath.Join(out, "a.jpg"), ActionSkip, false},
+		{ConflictRename, filepath.Join(out, "a (2).jpg"), ActionMove, false},
+		{ConflictOverwrite, filepath.Join(out, "a.jpg"), ActionMove, true},
+	}
+
+	for _, test := range tests {
+		conflictPolicy = test.policy
+		builder := newDestinationBuilder(dir, out, false)
+		op := builder.Operation(&Node{FileName: "a.jpg"}, 1)
+		if op == nil || !op.Conflict || op.Destination != test.destination || op.Action != test.action || op.Overwrite != test.overwrite {
+			t.Errorf("Operation with -on-conflict %s is incorrect. Got %+v, Expected (%s, %s, overwrite=%t)",
+				test.policy, op, test.destination, test.action, test.overwrite)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// Machine-readable formats operations can be written in with -format
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+var outputFormats = []string{FormatJSON, FormatNDJSON, FormatCSV}
+
+// ValidateOutputFormat returns an error if format is not one of the
+// supported output formats
+func ValidateOutputFormat(format string) error {
+	for _, f := range outputFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return groupbyError("Unknown format '" + format + "', expected one of " + strings.Join(outputFormats, ", "))
+}
+
+// WriteOperations writes the operations to w in the given format: a JSON
+// array, one JSON object per line or CSV with a header row
+func WriteOperations(w io.Writer, format string, ops []*Operation) error {
+	switch format {
+	case FormatJSON:
+		if ops == nil {
+			ops = []*Operation{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(ops)
+	case FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, op := range ops {
+			if err := encoder.Encode(op); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"source", "destination", "date", "date_source", "action"})
+		for _, op := range ops {
+			writer.Write([]string{op.Source, op.Destination, op.Date.Format(time.RFC3339), op.DateSource, op.Action})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return ValidateOutputFormat(format)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteOperations(t *testing.T) {
+	ops := []*Operation{
+		{Source: "a.jpg", Destination: "2019/July/a.jpg", Date: time.Date(2019, time.July, 5, 12, 0, 0, 0, time.UTC), DateSource: DateSourceExif, Action: ActionMove},
+		{Source: "b, c.jpg", Destination: "2019/July/b, c.jpg", Date: time.Date(2019, time.July, 6, 12, 0, 0, 0, time.UTC), DateSource: DateSourceModified, Action: ActionLink},
+	}
+
+	var out bytes.Buffer
+	if err := WriteOperations(&out, FormatJSON, ops); err != nil {
+		t.Fatalf("WriteOperations(json) returned an error: %s", err)
+	}
+	var decoded []Operation
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[0].DateSource != DateSourceExif {
+		t.Errorf("WriteOperations(json) output is incorrect: %s", out.String())
+	}
+
+	out.Reset()
+	if err := WriteOperations(&out, FormatNDJSON, ops); err != nil {
+		t.Fatalf("WriteOperations(ndjson) returned an error: %s", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 {
+		t.Errorf("WriteOperations(ndjson) wrote %d lines, Expected 2", len(lines))
+	}
+
+	out.Reset()
+	if err := WriteOperations(&out, FormatCSV, ops); err != nil {
+		t.Fatalf("WriteOperations(csv) returned an error: %s", err)
+	}
+	expected := "source,destination,date,date_source,action\n" +
+		"a.jpg,2019/July/a.jpg,2019-07-05T12:00:00Z,exif,move\n" +
+		"\"b, c.jpg\",\"2019/July/b, c.jpg\",2019-07-06T12:00:00Z,modified,link\n"
+	if out.String() != expected {
+		t.Errorf("WriteOperations(csv) is incorrect. Got '%s', Expected '%s'", out.String(), expected)
+	}
+
+	if err := WriteOperations(&out, "xml", ops); err == nil {
+		t.Errorf("WriteOperations(xml) should fail")
+	}
+}
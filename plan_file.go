@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// planFileVersion is the version of the plan file format written by plan.
+// apply refuses plans of any other version.
+const planFileVersion = 1
+
+// PlanFile is the file written by the plan command and executed by apply
+type PlanFile struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Directory string    `json:"directory"`
+	Output    string    `json:"output"`
+	// DirectoryMode is the permissions the destination directories are
+	// created with
+	DirectoryMode os.FileMode         `json:"directory_mode"`
+	Operations    []*PlannedOperation `json:"operations"`
+}
+
+// PlannedOperation is an operation along with the size and modification
+// time its source had when it was planned
+type PlannedOperation struct {
+	Operation
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// NewPlanFile returns the plan for the operations grouping dir into output,
+// recording the current state of their sources. All paths are made absolute
+// so the plan can be applied from any directory.
+func NewPlanFile(dir, output string, ops []*Operation) (*PlanFile, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return nil, err
+	}
+	plan := &PlanFile{
+		Version:       planFileVersion,
+		CreatedAt:     time.Now(),
+		Directory:     absDir,
+		Output:        absOutput,
+		DirectoryMode: 0755,
+		Operations:    make([]*PlannedOperation, 0, len(ops)),
+	}
+	if stat, err := os.Stat(dir); err == nil {
+		plan.DirectoryMode = stat.Mode().Perm()
+	}
+
+	for _, op := range ops {
+		planned := &PlannedOperation{Operation: *op}
+		if planned.Source, err = filepath.Abs(op.Source); err != nil {
+			return nil, err
+		}
+		if planned.Destination, err = filepath.Abs(op.Destination); err != nil {
+			return nil, err
+		}
+		stat, err := os.Stat(op.fingerprinted())
+		if err != nil {
+			return nil, err
+		}
+		planned.Size = stat.Size()
+		planned.ModTime = stat.ModTime()
+		plan.Operations = append(plan.Operations, planned)
+	}
+	return plan, nil
+}
+
+// ReadPlanFile reads a plan written by WritePlanFile
+func ReadPlanFile(r io.Reader) (*PlanFile, error) {
+	plan := &PlanFile{}
+	if err := json.NewDecoder(r).Decode(plan); err != nil {
+		return nil, fmt.Errorf("invalid plan file: %w", err)
+	}
+	if plan.Version != planFileVersion {
+		return nil, groupbyError("Unsupported plan file version " + strconv.Itoa(plan.Version) +
+			", expected " + strconv.Itoa(planFileVersion))
+	}
+	return plan, nil
+}
+
+// WritePlanFile writes the plan as JSON
+func WritePlanFile(w io.Writer, plan *PlanFile) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
+
+// fingerprinted returns the path of the file whose size and modification
+// time are recorded for the operation: its source, or for the link of a
+// duplicate to its original, the original where it is now. The source of
+// such a link is the destination of the original, made when the original is
+// grouped.
+func (op *Operation) fingerprinted() string {
+	if op.Action != ActionLink || op.DuplicateOf == "" {
+		return op.Source
+	}
+	if _, err := os.Lstat(op.Source); err == nil {
+		return op.Source
+	}
+	return op.DuplicateOf
+}
+
+// SourceChanged returns true if the source of the operation no longer exists
+// or its size or modification time differ from when it was planned
+func (op *PlannedOperation) SourceChanged() bool {
+	stat, err := os.Stat(op.fingerprinted())
+	if err != nil {
+		return true
+	}
+	return stat.Size() != op.Size || !stat.ModTime().Equal(op.ModTime)
+}
+
+// Changed returns the operations whose source changed since planning
+func (p *PlanFile) Changed() []*PlannedOperation {
+	var changed []*PlannedOperation
+	for _, op := range p.Operations {
+		if op.Action != ActionSkip && op.SourceChanged() {
+			changed = append(changed, op)
+		}
+	}
+	return changed
+}
+
+// OutputDirectory returns the directory the plan groups files into
+func (p *PlanFile) OutputDirectory() string {
+	if p.Output == "" {
+		return p.Directory
+	}
+	return p.Output
+}
+
+// Pending returns the planned operations to perform, along with the ones
+// skipped because their source changed since planning
+func (p *PlanFile) Pending() (planned, skipped []*PlannedOperation) {
+	for _, op := range p.Operations {
+		if op.Action == ActionSkip {
+			continue
+		}
+		if op.SourceChanged() {
+			skipped = append(skipped, op)
+			continue
+		}
+		planned = append(planned, op)
+	}
+	return planned, skipped
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanFileApply(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ops := []*Operation{
+		{Source: filepath.Join(dir, "a.jpg"), Destination: filepath.Join(dir, "2019", "a.jpg"), Action: ActionMove},
+		{Source: filepath.Join(dir, "b.jpg"), Destination: filepath.Join(dir, "2019", "b.jpg"), Action: ActionMove},
+	}
+
+	plan, err := NewPlanFile(dir, dir, ops)
+	if err != nil {
+		t.Fatalf("NewPlanFile returned an error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err = WritePlanFile(&buf, plan); err != nil {
+		t.Fatalf("WritePlanFile returned an error: %s", err)
+	}
+	plan, err = ReadPlanFile(&buf)
+	if err != nil {
+		t.Fatalf("ReadPlanFile returned an error: %s", err)
+	}
+
+	// b.jpg changes after planning
+	later := time.Now().Add(time.Hour)
+	if err = os.Chtimes(filepath.Join(dir, "b.jpg"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed := plan.Changed(); len(changed) != 1 || filepath.Base(changed[0].Source) != "b.jpg" {
+		t.Errorf("PlanFile.Changed() is incorrect. Got %v, Expected [b.jpg]", changed)
+	}
+
+	journal := NewJournal(dir)
+	code := applyPlan("apply", plan, journal)
+	journal.Close()
+	if code != ExitOK {
+		t.Errorf("applyPlan exit code is incorrect. Got '%d', Expected '%d'", code, ExitOK)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2019", "a.jpg")); err != nil {
+		t.Errorf("applyPlan did not move a.jpg: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.jpg")); err != nil {
+		t.Errorf("applyPlan moved b.jpg which changed since planning")
+	}
+	if entries, err := ReadJournal(journal.Path); err != nil || len(entries) != 1 {
+		t.Errorf("applyPlan recorded %d operations (%v), Expected 1", len(entries), err)
+	}
+}
+
+func TestReadPlanFileVersion(t *testing.T) {
+	if _, err := ReadPlanFile(strings.NewReader(`{"version": 99, "operations": []}`)); err == nil {
+		t.Errorf("ReadPlanFile should refuse an unsupported version")
+	}
+}
+
+func TestApplyDestinationConflict(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.jpg")
+	os.WriteFile(source, []byte("a.jpg"), 0644)
+	ops := []*Operation{{Source: source, Destination: filepath.Join(dir, "2019", "a.jpg"), Action: ActionMove}}
+	plan, err := NewPlanFile(dir, dir, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file appears at the destination after planning
+	os.Mkdir(filepath.Join(dir, "2019"), 0755)
+	os.WriteFile(ops[0].Destination, []byte("PRECIOUS"), 0644)
+
+	journal := NewJournal(dir)
+	code := applyPlan("apply", plan, journal)
+	journal.Close()
+	if code != ExitPartialFailure {
+		t.Errorf("applyPlan exit code is incorrect. Got '%d', Expected '%d'", code, ExitPartialFailure)
+	}
+	if content, _ := os.ReadFile(ops[0].Destination); string(content) != "PRECIOUS" {
+		t.Errorf("applyPlan replaced the file at the destination. Got '%s', Expected 'PRECIOUS'", content)
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Errorf("applyPlan moved a.jpg onto another file: %s", err)
+	}
+}
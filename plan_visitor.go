@@ -0,0 +1,19 @@
+package main
+
+// PlanVisitor collects the operations grouping the tree would perform,
+// without touching any files
+type PlanVisitor struct {
+	NodeVisitor
+	destinations *destinationBuilder
+	Operations   []*Operation
+}
+
+func NewPlanVisitor(root, output string, flatten bool) *PlanVisitor {
+	return &PlanVisitor{
+		destinations: newDestinationBuilder(root, output, flatten),
+	}
+}
+
+func (p *PlanVisitor) Visit(n *Node, depth int) {
+	p.Operations = append(p.Operations, p.destinations.Operations(n, depth)...)
+}
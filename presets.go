@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+)
+
+// preset is a built-in recipe, written like a profile of the configuration
+// file
+type preset struct {
+	Name        string
+	Description string
+	Config      string
+}
+
+// presets are the built-in presets in the order they are listed
+var presets = []preset{
+	{
+		Name:        "photos",
+		Description: "Camera import: photos and videos by day, dated by EXIF",
+		Config: `date-source = ["exif", "modified"]
+layout = "day"
+ignore-directories = true
+sidecars = "` + photoSidecars + `"
+
+[[rules]]
+name = "photos and videos"
+type = ["image", "video"]
+
+[[rules]]
+name = "everything else"
+action = "skip"
+`,
+	},
+	{
+		Name:        "screenshots",
+		Description: "Screenshot archive: screenshots by month",
+		Config: `layout = "month"
+ignore-directories = true
+
+[[rules]]
+name = "screenshots"
+regex = '(?i)^(screen ?shot|screenshot|scr|capture)[ _-]'
+type = "image"
+
+[[rules]]
+name = "everything else"
+action = "skip"
+`,
+	},
+	{
+		Name:        "downloads",
+		Description: "Downloads cleanup: by month, leaving installers, unfinished and recent downloads alone",
+		Config: `layout = "month"
+
+[[rules]]
+name = "installers"
+type = "installer"
+action = "skip"
+
+[[rules]]
+name = "unfinished downloads"
+regex = '\.(part|crdownload|download|tmp)$'
+action = "skip"
+
+[[rules]]
+name = "recent downloads"
+newer-than = "1d"
+action = "skip"
+`,
+	},
+	{
+		Name:        "logs",
+		Description: "Log archive: rotated logs by day, leaving the logs still written to alone",
+		Config: `layout = "day"
+ignore-directories = true
+
+[[rules]]
+name = "active logs"
+newer-than = "1h"
+action = "skip"
+
+[[rules]]
+name = "logs"
+regex = '\.log(\.\d+)?(\.(gz|bz2|xz|zip))?$'
+
+[[rules]]
+name = "everything else"
+action = "skip"
+`,
+	},
+}
+
+// findPreset returns the built-in preset with the name, or nil
+func findPreset(name string) *preset {
+	for i := range presets {
+		if presets[i].Name == name {
+			return &presets[i]
+		}
+	}
+	return nil
+}
+
+// PresetNames returns the names of the built-in presets
+func PresetNames() []string {
+	names := make([]string, len(presets))
+	for i, p := range presets {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// Preset returns the table of the named preset, with the fields of the
+// [presets.NAME] table of the configuration taking the place of the built-in
+// ones. The configuration may also define presets of its own.
+func Preset(name string, config configTable) (configTable, error) {
+	table := configTable{}
+	if p := findPreset(name); p != nil {
+		builtin, err := ParseConfig(strings.NewReader(p.Config))
+		if err != nil {
+			return nil, err
+		}
+		table = builtin
+	}
+
+	overrides, _ := config["presets"].(configTable)
+	custom, ok := overrides[name].(configTable)
+	if ok {
+		mergeConfig(table, custom)
+	} else if findPreset(name) == nil {
+		return nil, groupbyError("Unknown preset '" + name + "', expected one of " + strings.Join(PresetNames(), ", "))
+	}
+	return table, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestPresetsParse(t *testing.T) {
+	for _, name := range PresetNames() {
+		table, err := Preset(name, configTable{})
+		if err != nil {
+			t.Errorf("Preset(%s) returned an error: %s", name, err)
+			continue
+		}
+		tables, _ := table["rules"].([]configTable)
+		if _, err := ParseRules(tables); err != nil {
+			t.Errorf("Preset(%s) rules are invalid: %s", name, err)
+		}
+	}
+
+	if _, err := Preset("bogus", configTable{}); err == nil {
+		t.Errorf("Preset(\"bogus\") should fail")
+	}
+}
+
+func TestPresetOverrides(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(`
+[presets.photos]
+layout = "month"
+
+[presets.scans]
+layout = "year"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	photos, err := Preset("photos", config)
+	if err != nil {
+		t.Fatalf("Preset(photos) returned an error: %s", err)
+	}
+	if photos["layout"] != "month" {
+		t.Errorf("Preset(photos) layout is incorrect. Got '%v', Expected 'month'", photos["layout"])
+	}
+	if sources, ok := photos["date-source"].([]interface{}); !ok || len(sources) != 2 {
+		t.Errorf("Preset(photos) should keep the built-in date-source. Got '%v'", photos["date-source"])
+	}
+	if _, err := Preset("scans", config); err != nil {
+		t.Errorf("Preset(scans) should find the preset of the configuration: %s", err)
+	}
+}
+
+func TestSetLayout(t *testing.T) {
+	defer func() {
+		addGroupingFlags(flag.NewFlagSet("reset", flag.ContinueOnError))
+	}()
+
+	tests := []struct {
+		args     []string
+		layouts  []string
+		expected int
+	}{
+		{[]string{}, []string{"day"}, 3},
+		{[]string{}, []string{"day", "month"}, 2},
+		{[]string{"-year"}, []string{"day"}, 1},
+	}
+
+	for _, test := range tests {
+		flags := flag.NewFlagSet("group", flag.ContinueOnError)
+		addGroupingFlags(flags)
+		flags.Parse(test.args)
+		given := map[string]bool{}
+		flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+		for _, layout := range test.layouts {
+			if err := (configTable{"layout": layout}).ApplyTo(flags, given); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := 0
+		for i, set := range []bool{year, month, day} {
+			if set {
+				got = i + 1
+			}
+		}
+		if got != test.expected {
+			t.Errorf("Layout of %v with %v is incorrect. Got depth %d, Expected %d", test.args, test.layouts, got, test.expected)
+		}
+	}
+}
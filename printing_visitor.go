@@ -34,7 +34,13 @@ func (p *PrintingVisitor) Visit(n *Node, depth int) {
 		prefix = SubdirectoryLink
 	}
 
-	filename := FileNameByDepth(n.FileName, depth)
+	filename := NodeName(n, depth)
+	for i, c := range n.Companions {
+		if i == 0 {
+			filename += " +"
+		}
+		filename += " " + c.FileName
+	}
 
 	fmt.Println(prefix, filename)
 
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress modes
+const (
+	// ProgressAuto shows a progress line when stderr is a terminal
+	ProgressAuto = "auto"
+	ProgressLine = "line"
+	// ProgressJSON writes a JSON object per line every -progress-interval,
+	// for scripts wrapping groupby
+	ProgressJSON = "json"
+	ProgressNone = "none"
+)
+
+var progressModes = []string{ProgressAuto, ProgressLine, ProgressJSON, ProgressNone}
+
+// lineRefresh is how often the progress line is redrawn
+const lineRefresh = 200 * time.Millisecond
+
+// ValidateProgressMode returns an error if mode isn't one of the progress
+// modes
+func ValidateProgressMode(mode string) error {
+	for _, m := range progressModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return groupbyError("Invalid progress mode '" + mode + "', expected one of " + strings.Join(progressModes, ", "))
+}
+
+// Progress reports how many of the operations of a run are done, the bytes
+// moved, the rate and the time left. Its methods do nothing on a nil
+// Progress.
+type Progress struct {
+	out      io.Writer
+	mode     string
+	interval time.Duration
+
+	mu         sync.Mutex
+	start      time.Time
+	total      int
+	totalBytes int64
+	done       int
+	doneBytes  int64
+	failed     int
+	width      int
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	// writing keeps the lines written by the workers whole
+	writing sync.Mutex
+}
+
+// ProgressStatus is a snapshot of the progress, as written in json mode
+type ProgressStatus struct {
+	Done       int     `json:"done"`
+	Total      int     `json:"total"`
+	Failed     int     `json:"failed"`
+	BytesDone  int64   `json:"bytes_done"`
+	BytesTotal int64   `json:"bytes_total"`
+	Rate       float64 `json:"bytes_per_second"`
+	Elapsed    float64 `json:"elapsed_seconds"`
+	ETA        float64 `json:"eta_seconds"`
+}
+
+// ProgressFailure is written in json mode for each operation that failed,
+// as {"failure": {...}}. Code is the code of the error, if it has one.
+type ProgressFailure struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Code        string `json:"code,omitempty"`
+	Error       string `json:"error"`
+}
+
+// NewProgress returns the progress of the -progress mode written to w, or
+// nil if there is nothing to show. In auto mode a progress line is shown if
+// w is a terminal.
+func NewProgress(w io.Writer, mode string, interval time.Duration) *Progress {
+	if mode == ProgressAuto {
+		mode = ProgressNone
+		if isTerminal(w) {
+			mode = ProgressLine
+		}
+	}
+	if mode == ProgressNone {
+		return nil
+	}
+	if mode == ProgressLine {
+		interval = lineRefresh
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Progress{out: w, mode: mode, interval: interval}
+}
+
+// isTerminal returns true if w is a character device such as a terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Start counts the operations and the bytes of their sources, and starts
+// reporting every interval until Finish
+func (p *Progress) Start(ops []*Operation) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.start = time.Now()
+	for _, op := range ops {
+		if op.Action == ActionSkip {
+			continue
+		}
+		p.total++
+		p.totalBytes += operationSize(op)
+	}
+	p.mu.Unlock()
+
+	p.stop = make(chan struct{})
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.report(false)
+			}
+		}
+	}()
+}
+
+// operationSize returns the size of the file moved or copied by the
+// operation, 0 for directories and links
+func operationSize(op *Operation) int64 {
+	stat, err := os.Lstat(op.Source)
+	if err != nil || !stat.Mode().IsRegular() {
+		return 0
+	}
+	return stat.Size()
+}
+
+// Done records that the operation finished, failing if err isn't nil. The
+// size of its source must be given, as the source is gone once moved. In
+// json mode failures are written as they happen.
+func (p *Progress) Done(op *Operation, size int64, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.done++
+	p.doneBytes += size
+	if err != nil {
+		p.failed++
+	}
+	p.mu.Unlock()
+
+	if err != nil && p.mode == ProgressJSON {
+		line, _ := json.Marshal(struct {
+			Failure ProgressFailure `json:"failure"`
+		}{ProgressFailure{op.Source, op.Destination, ErrorCode(err), err.Error()}})
+		p.write(string(line) + "\n")
+	}
+}
+
+func (p *Progress) write(s string) {
+	p.writing.Lock()
+	defer p.writing.Unlock()
+	io.WriteString(p.out, s)
+}
+
+// Finish stops reporting and writes the final progress
+func (p *Progress) Finish() {
+	if p == nil || p.stop == nil {
+		return
+	}
+	close(p.stop)
+	p.stopped.Wait()
+	p.report(true)
+}
+
+// Status returns a snapshot of the progress
+func (p *Progress) Status() ProgressStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := ProgressStatus{
+		Done:       p.done,
+		Total:      p.total,
+		Failed:     p.failed,
+		BytesDone:  p.doneBytes,
+		BytesTotal: p.totalBytes,
+		Elapsed:    time.Since(p.start).Seconds(),
+	}
+	if status.Elapsed > 0 {
+		status.Rate = float64(p.doneBytes) / status.Elapsed
+	}
+	// The time left is estimated from the bytes when there are any, as
+	// large files take longer, and from the number of files otherwise
+	switch {
+	case p.totalBytes > 0 && p.doneBytes > 0:
+		status.ETA = status.Elapsed * float64(p.totalBytes-p.doneBytes) / float64(p.doneBytes)
+	case p.totalBytes == 0 && p.done > 0:
+		status.ETA = status.Elapsed * float64(p.total-p.done) / float64(p.done)
+	}
+	return status
+}
+
+func (p *Progress) report(final bool) {
+	status := p.Status()
+	if p.mode == ProgressJSON {
+		line, _ := json.Marshal(status)
+		p.write(string(line) + "\n")
+		return
+	}
+
+	line := fmt.Sprintf("%d/%d files, %s/%s, %s/s", status.Done, status.Total,
+		formatBytes(status.BytesDone), formatBytes(status.BytesTotal), formatBytes(int64(status.Rate)))
+	if status.Failed > 0 {
+		line += fmt.Sprintf(", %d failed", status.Failed)
+	}
+	if final {
+		line += fmt.Sprintf(" in %s", time.Duration(status.Elapsed*float64(time.Second)).Round(time.Second))
+	} else if status.Done > 0 {
+		line += fmt.Sprintf(", ETA %s", time.Duration(status.ETA*float64(time.Second)).Round(time.Second))
+	}
+
+	// The line is redrawn in place, padded to hide the end of a longer one
+	p.mu.Lock()
+	padding := p.width - len(line)
+	if len(line) > p.width {
+		p.width = len(line)
+	}
+	p.mu.Unlock()
+	if padding < 0 {
+		padding = 0
+	}
+	line = "\r" + line + strings.Repeat(" ", padding)
+	if final {
+		line += "\n"
+	}
+	p.write(line)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateProgressMode(t *testing.T) {
+	for _, mode := range progressModes {
+		if err := ValidateProgressMode(mode); err != nil {
+			t.Errorf("ValidateProgressMode(%s) is incorrect. Got '%s', Expected nil", mode, err)
+		}
+	}
+	if err := ValidateProgressMode("bar"); err == nil {
+		t.Errorf("ValidateProgressMode(bar) should return an error")
+	}
+}
+
+func TestNewProgress(t *testing.T) {
+	var out bytes.Buffer
+	if p := NewProgress(&out, ProgressAuto, time.Second); p != nil {
+		t.Errorf("NewProgress in auto mode should show nothing when not writing to a terminal")
+	}
+	if p := NewProgress(&out, ProgressNone, time.Second); p != nil {
+		t.Errorf("NewProgress in none mode should show nothing")
+	}
+	if p := NewProgress(&out, ProgressLine, time.Second); p == nil || p.interval != lineRefresh {
+		t.Errorf("NewProgress in line mode should redraw the line every %s", lineRefresh)
+	}
+}
+
+func TestProgressJSON(t *testing.T) {
+	dir := t.TempDir()
+	var ops []*Operation
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		source := filepath.Join(dir, name)
+		if err := os.WriteFile(source, []byte("12345"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, &Operation{Source: source, Destination: filepath.Join(dir, "2019", name), Action: ActionMove})
+	}
+	ops = append(ops, &Operation{Source: filepath.Join(dir, "missing.jpg"), Destination: filepath.Join(dir, "2019", "missing.jpg"), Action: ActionMove})
+
+	var out bytes.Buffer
+	progress := NewProgress(&out, ProgressJSON, time.Hour)
+	executor := &Executor{Perm: 0755, Jobs: 2, Progress: progress}
+	executor.Execute(ops)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var status ProgressStatus
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &status); err != nil {
+		t.Fatalf("Progress should write a JSON object per line. Got '%s': %s", out.String(), err)
+	}
+	var failure struct{ Failure ProgressFailure }
+	if err := json.Unmarshal([]byte(lines[0]), &failure); err != nil || failure.Failure.Code != CodeUnreadableSource {
+		t.Errorf("Progress should write failures with their code. Got '%s'", lines[0])
+	}
+	expected := ProgressStatus{Done: 4, Total: 4, Failed: 1, BytesDone: 15, BytesTotal: 15}
+	status.Rate, status.Elapsed, status.ETA = 0, 0, 0
+	if status != expected {
+		t.Errorf("Progress is incorrect. Got %+v, Expected %+v", status, expected)
+	}
+}
+
+func TestProgressETA(t *testing.T) {
+	p := &Progress{start: time.Now().Add(-10 * time.Second), total: 4, totalBytes: 400, done: 1, doneBytes: 100}
+	status := p.Status()
+	if status.ETA < 29 || status.ETA > 31 {
+		t.Errorf("Progress ETA is incorrect. Got %.1fs, Expected 30s", status.ETA)
+	}
+
+	p = &Progress{start: time.Now().Add(-10 * time.Second), total: 4, done: 2}
+	status = p.Status()
+	if status.ETA < 9 || status.ETA > 11 {
+		t.Errorf("Progress ETA without bytes is incorrect. Got %.1fs, Expected 10s", status.ETA)
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	var out bytes.Buffer
+	p := &Progress{out: &out, mode: ProgressLine, start: time.Now(), total: 2, done: 2, totalBytes: 2048, doneBytes: 2048}
+	p.report(true)
+	if got := out.String(); !strings.HasPrefix(got, "\r2/2 files, 2.0 KB/2.0 KB") || !strings.HasSuffix(got, "\n") {
+		t.Errorf("Progress line is incorrect. Got '%q'", got)
+	}
+}
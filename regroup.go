@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bucket is the date a grouped file was grouped by, as far as the names of
+// its folders tell. Precision is 1 when only the year is known, 2 with the
+// month and 3 with the day.
+type bucket struct {
+	Year      int
+	Month     time.Month
+	Day       int
+	Precision int
+}
+
+// eventTime matches the time in the names of event folders, e.g. 14.30
+var eventTime = regexp.MustCompile(`^\d{2}\.\d{2}$`)
+
+// parseBucket parses the names of the folders a file was grouped into, such
+// as 2019/July/5, 2019-07-05 Friday or an event folder like 2019-07-05 14.30.
+// Month and weekday names are recognized in every locale.
+func parseBucket(folders []string) (bucket, bool) {
+	var tokens []string
+	for _, folder := range folders {
+		tokens = append(tokens, strings.FieldsFunc(folder, func(r rune) bool {
+			return r == '-' || r == ' '
+		})...)
+	}
+
+	b := bucket{}
+	if len(tokens) == 0 || len(tokens[0]) != 4 {
+		return b, false
+	}
+	year, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		return b, false
+	}
+	b.Year, b.Precision, tokens = year, 1, tokens[1:]
+
+	if len(tokens) > 0 {
+		m, ok := parseMonth(tokens[0])
+		if !ok {
+			return b, false
+		}
+		tokens = tokens[1:]
+		// 01-January and 01 Jan name the month twice
+		if len(tokens) > 0 {
+			if named, ok := parseMonth(tokens[0]); ok && named == m && !isNumber(tokens[0]) {
+				tokens = tokens[1:]
+			}
+		}
+		b.Month, b.Precision = m, 2
+	}
+
+	if len(tokens) > 0 {
+		day, err := strconv.Atoi(tokens[0])
+		if err != nil || day < 1 || day > daysIn(b.Year, b.Month) {
+			return b, false
+		}
+		b.Day, b.Precision, tokens = day, 3, tokens[1:]
+
+		switch {
+		case len(tokens) == 0:
+		case eventTime.MatchString(tokens[0]):
+			// The rest is the label of the event
+			tokens = nil
+		case isWeekday(strings.Join(tokens, "-")) || isWeekday(strings.Join(tokens, " ")):
+			tokens = nil
+		}
+	}
+	return b, len(tokens) == 0
+}
+
+// parseMonth parses a month number or a full or short month name
+func parseMonth(s string) (time.Month, bool) {
+	if isNumber(s) {
+		m, _ := strconv.Atoi(s)
+		return time.Month(m), m >= 1 && m <= 12
+	}
+	for _, l := range append([]*Locale{currentLocale}, allLocales()...) {
+		for i := 0; i < 12; i++ {
+			if strings.EqualFold(s, l.Months[i]) || strings.EqualFold(s, l.ShortMonths[i]) {
+				return time.Month(i + 1), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// isWeekday returns true if s is a full or short weekday name
+func isWeekday(s string) bool {
+	for _, l := range append([]*Locale{currentLocale}, allLocales()...) {
+		for i := 0; i < 7; i++ {
+			if strings.EqualFold(s, l.Weekdays[i]) || strings.EqualFold(s, l.ShortWeekdays[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func allLocales() []*Locale {
+	all := make([]*Locale, 0, len(locales))
+	for _, name := range LocaleNames() {
+		all = append(all, locales[name])
+	}
+	return all
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// daysIn returns the number of days of the month, 31 if it isn't known
+func daysIn(year int, month time.Month) int {
+	if month == 0 {
+		return 31
+	}
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// Regroup adds the files of the grouped folders of the tree's directory to
+// the tree at the dates of their folders, so they are grouped again with the
+// tree's depth. Finer levels than the folders have come from the date of the
+// file; files whose date doesn't fall in their folder are left alone. It
+// returns the folders the files were found in, deepest first, so the ones
+// emptied can be removed. Companions go with the file of their folder they
+// go with, like when grouping.
+func (t *Tree) Regroup() ([]string, error) {
+	type grouped struct {
+		path  string
+		entry os.FileInfo
+		b     bucket
+	}
+	var dirs []string
+	byDir := map[string][]grouped{}
+	folders, err := walkGrouped(t.Root.FileName, func(path string, entry os.FileInfo, b bucket) {
+		dir := filepath.Dir(path)
+		if byDir[dir] == nil {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], grouped{path, entry, b})
+	})
+
+	exts := ParseSidecarExtensions(sidecarExtensions)
+	for _, dir := range dirs {
+		entries := make([]os.FileInfo, len(byDir[dir]))
+		for i, g := range byDir[dir] {
+			entries[i] = g.entry
+		}
+		sidecars := FindSidecars(entries, exts)
+		companions := map[string]bool{}
+		for _, files := range sidecars {
+			for _, f := range files {
+				companions[f.Name()] = true
+			}
+		}
+		for _, g := range byDir[dir] {
+			if !companions[g.entry.Name()] {
+				t.addRegrouped(g.path, g.entry, g.b, sidecars[g.entry.Name()])
+			}
+		}
+	}
+	return folders, err
+}
+
+// walkGrouped calls fn for every file and grouped directory in the date
+// folders of dir, along with the date of its folders. Entries of dir itself
+// and folders that aren't dates are left alone. It returns the date folders,
+// deepest first.
+func walkGrouped(dir string, fn func(path string, entry os.FileInfo, b bucket)) ([]string, error) {
+	var folders []string
+	err := walkGroupedDir(dir, nil, &folders, fn)
+	sort.Slice(folders, func(i, j int) bool {
+		return len(folders[i]) > len(folders[j])
+	})
+	return folders, err
+}
+
+func walkGroupedDir(dir string, names []string, folders *[]string, fn func(string, os.FileInfo, bucket)) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := file.Readdir(-1)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	current, _ := parseBucket(names)
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == stateDirName || name == manifestName || strings.HasPrefix(name, ".") && !includeHidden {
+			continue
+		}
+		path := filepath.Join(dir, name)
+
+		// A folder is a finer level of the date, or a grouped directory
+		if entry.IsDir() && current.Precision < 3 {
+			sub := append(names[:len(names):len(names)], name)
+			if b, ok := parseBucket(sub); ok && b.Precision > current.Precision {
+				*folders = append(*folders, path)
+				if err := walkGroupedDir(path, sub, folders, fn); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		// Entries of the directory itself weren't grouped
+		if len(names) == 0 {
+			continue
+		}
+		fn(path, entry, current)
+	}
+	return nil
+}
+
+// addRegrouped adds the grouped file at path to the tree along with its
+// companions, which are dated like it
+func (t *Tree) addRegrouped(path string, entry os.FileInfo, b bucket, sidecars []os.FileInfo) {
+	tm, source := FileDate(path, entry)
+	year, month, day := BucketYMD(tm)
+	if b.Precision < t.MaxDepth {
+		if year != b.Year || b.Precision == 2 && month != b.Month {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Leaving %s alone, its date isn't in its folder\n", path)
+			}
+			return
+		}
+	}
+	if b.Precision >= 2 {
+		month = b.Month
+	}
+	if b.Precision == 3 {
+		day = b.Day
+	}
+	if !t.count(entry) {
+		return
+	}
+
+	t.fileCount += len(sidecars)
+
+	node := NewNode(entry.Name(), b.Year, month, day)
+	node.Source = path
+	node.Date = tm
+	node.DateSource = source
+	for _, sidecar := range sidecars {
+		companion := NewNode(sidecar.Name(), b.Year, month, day)
+		companion.Source = filepath.Join(filepath.Dir(path), sidecar.Name())
+		companion.Date = tm
+		companion.DateSource = source
+		node.Companions = append(node.Companions, companion)
+	}
+	t.addNode(node)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseBucket(t *testing.T) {
+	tests := []struct {
+		folders  []string
+		expected bucket
+		ok       bool
+	}{
+		{[]string{"2019"}, bucket{2019, 0, 0, 1}, true},
+		{[]string{"2019", "July"}, bucket{2019, time.July, 0, 2}, true},
+		{[]string{"2019", "07-July", "05 Fri"}, bucket{2019, time.July, 5, 3}, true},
+		{[]string{"2019", "7", "5"}, bucket{2019, time.July, 5, 3}, true},
+		{[]string{"2019-Juli-5"}, bucket{2019, time.July, 5, 3}, true},
+		{[]string{"2019", "julho", "05-sexta-feira"}, bucket{2019, time.July, 5, 3}, true},
+		{[]string{"2019-07-05 14.30 Lake trip"}, bucket{2019, time.July, 5, 3}, true},
+		{[]string{"2019", "February", "30"}, bucket{}, false},
+		{[]string{"2019", "Trip"}, bucket{}, false},
+		{[]string{"Photos"}, bucket{}, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseBucket(test.folders)
+		if ok != test.ok || ok && got != test.expected {
+			t.Errorf("parseBucket(%v) is incorrect. Got %+v (%t), Expected %+v (%t)", test.folders, got, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestRegroup(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2019, time.July, 20, 12, 0, 0, 0, time.Local)
+	files := []string{
+		filepath.Join("2019", "July", "5", "a.jpg"),
+		filepath.Join("2019", "July", "20", "b.jpg"),
+		filepath.Join("2019", "July", "20", "Trip", "c.jpg"),
+		filepath.Join("2019", "July", "d.jpg"),
+		filepath.Join("2018", "e.jpg"),
+		"f.jpg",
+	}
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, date, date)
+	}
+
+	// e.jpg is left alone as its date isn't in 2018, f.jpg wasn't grouped
+	tests := []struct {
+		depth    int
+		expected map[string]string
+	}{
+		{2, map[string]string{
+			"a.jpg": filepath.Join("out", "2019", "July", "a.jpg"),
+			"b.jpg": filepath.Join("out", "2019", "July", "b.jpg"),
+			"Trip":  filepath.Join("out", "2019", "July", "Trip"),
+			"d.jpg": filepath.Join("out", "2019", "July", "d.jpg"),
+		}},
+		// d.jpg gets its day from its date
+		{3, map[string]string{
+			"a.jpg": filepath.Join("out", "2019", "July", "5", "a.jpg"),
+			"b.jpg": filepath.Join("out", "2019", "July", "20", "b.jpg"),
+			"Trip":  filepath.Join("out", "2019", "July", "20", "Trip"),
+			"d.jpg": filepath.Join("out", "2019", "July", "20", "d.jpg"),
+		}},
+	}
+
+	for _, test := range tests {
+		tree, err := NewTree(dir, test.depth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tree.Regroup(); err != nil {
+			t.Fatalf("Regroup returned an error: %s", err)
+		}
+		visitor := NewPlanVisitor(dir, "out", false)
+		tree.Visit(visitor)
+
+		if len(visitor.Operations) != len(test.expected) {
+			t.Errorf("Regroup to depth %d planned %d operations, Expected %d", test.depth, len(visitor.Operations), len(test.expected))
+		}
+		for _, op := range visitor.Operations {
+			if expected := test.expected[filepath.Base(op.Source)]; op.Destination != expected {
+				t.Errorf("Regroup to depth %d destination is incorrect. Got '%s', Expected '%s'", test.depth, op.Destination, expected)
+			}
+		}
+	}
+}
+
+func TestRegroupSidecars(t *testing.T) {
+	defer func(s string) { sidecarExtensions = s }(sidecarExtensions)
+	sidecarExtensions = "xmp"
+	dir := t.TempDir()
+	// The sidecar was written just after midnight, its file just before
+	os.MkdirAll(filepath.Join(dir, "2019", "March"), 0755)
+	for name, date := range map[string]time.Time{
+		"IMG_1.JPG": time.Date(2019, 3, 5, 23, 59, 59, 0, time.Local),
+		"IMG_1.xmp": time.Date(2019, 3, 6, 0, 0, 1, 0, time.Local),
+	} {
+		path := filepath.Join(dir, "2019", "March", name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, date, date)
+	}
+
+	tree, err := NewTree(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Regroup(); err != nil {
+		t.Fatalf("Regroup returned an error: %s", err)
+	}
+	if tree.Files() != 2 {
+		t.Errorf("Regrouped tree's Files() with a sidecar is incorrect. Got '%d', Expected '%d'", tree.Files(), 2)
+	}
+	visitor := NewPlanVisitor(dir, dir, false)
+	tree.Visit(visitor)
+
+	if len(visitor.Operations) != 2 {
+		t.Fatalf("Regroup with a sidecar planned %d operations, Expected 2", len(visitor.Operations))
+	}
+	for _, op := range visitor.Operations {
+		expected := filepath.Join(dir, "2019", "March", "5", filepath.Base(op.Source))
+		if op.Destination != expected {
+			t.Errorf("Regroup with a sidecar destination is incorrect. Got '%s', Expected '%s'", op.Destination, expected)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule actions
+const (
+	RuleMove = "move"
+	RuleCopy = "copy"
+	// RuleSkip leaves the matching files where they are
+	RuleSkip = "skip"
+)
+
+// ruleLayouts are the layouts a rule may group its files with and the depth
+// of each
+var ruleLayouts = map[string]int{
+	"year":  1,
+	"month": 2,
+	"day":   3,
+}
+
+// fileTypes are the names a rule's type may use for groups of extensions
+var fileTypes = map[string][]string{
+	"image":     {".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp", ".heic", ".heif", ".raw", ".cr2", ".nef", ".arw", ".dng"},
+	"video":     {".mp4", ".mov", ".avi", ".mkv", ".m4v", ".wmv", ".webm", ".3gp", ".mts"},
+	"audio":     {".mp3", ".wav", ".flac", ".m4a", ".aac", ".ogg", ".wma", ".opus"},
+	"document":  {".pdf", ".doc", ".docx", ".odt", ".rtf", ".txt", ".md", ".xls", ".xlsx", ".ods", ".csv", ".ppt", ".pptx", ".odp", ".epub"},
+	"archive":   {".zip", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".7z", ".rar"},
+	"installer": {".exe", ".msi", ".dmg", ".pkg", ".deb", ".rpm", ".appimage", ".apk"},
+}
+
+// Rule routes the entries it matches to its own output directory, layout and
+// action. The zero value of a condition matches every entry.
+type Rule struct {
+	Name  string
+	Glob  string
+	Regex *regexp.Regexp
+	// Types are file types such as image or directory, or extensions
+	// such as .pdf
+	Types   []string
+	MinSize int64
+	MaxSize int64
+	// MinAge and MaxAge are compared with the time since the entry was
+	// modified
+	MinAge time.Duration
+	MaxAge time.Duration
+	Output string
+	// Depth is the depth of the layout, 0 for the depth of the run
+	Depth  int
+	Action string
+}
+
+// rules are the rules of the configuration, tried in order for every entry
+var rules []*Rule
+
+// Route is a rule along with the tree of the entries routed to it
+type Route struct {
+	Rule *Rule
+	Tree *Tree
+}
+
+// Output returns the directory the route groups into, the output directory
+// of the run if the rule doesn't have one
+func (r *Route) Output() string {
+	if r.Rule.Output == "" {
+		return outputDirectory
+	}
+	return r.Rule.Output
+}
+
+// destinations returns the builder working out where the files of the route
+// are grouped into
+func (r *Route) destinations(root string, flatten bool) *destinationBuilder {
+	b := newDestinationBuilder(root, r.Output(), flatten)
+	b.copyOnly = r.Rule.Action == RuleCopy
+	return b
+}
+
+// String returns the name of the rule, or its conditions if it has none
+func (r *Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	var conditions []string
+	if r.Glob != "" {
+		conditions = append(conditions, r.Glob)
+	}
+	if r.Regex != nil {
+		conditions = append(conditions, "/"+r.Regex.String()+"/")
+	}
+	if len(r.Types) > 0 {
+		conditions = append(conditions, strings.Join(r.Types, ","))
+	}
+	if len(conditions) == 0 {
+		return "rule"
+	}
+	return strings.Join(conditions, " ")
+}
+
+// Match returns true if the entry meets every condition of the rule
+func (r *Rule) Match(fi os.FileInfo, now time.Time) bool {
+	name := fi.Name()
+	if r.Glob != "" {
+		if ok, _ := filepath.Match(r.Glob, name); !ok {
+			return false
+		}
+	}
+	if r.Regex != nil && !r.Regex.MatchString(name) {
+		return false
+	}
+	if len(r.Types) > 0 && !matchType(r.Types, fi) {
+		return false
+	}
+	if !fi.IsDir() {
+		if r.MinSize > 0 && fi.Size() < r.MinSize {
+			return false
+		}
+		if r.MaxSize > 0 && fi.Size() > r.MaxSize {
+			return false
+		}
+	}
+	age := now.Sub(fi.ModTime())
+	if r.MinAge > 0 && age < r.MinAge {
+		return false
+	}
+	if r.MaxAge > 0 && age > r.MaxAge {
+		return false
+	}
+	return true
+}
+
+// matchType returns true if the entry is of one of the types
+func matchType(types []string, fi os.FileInfo) bool {
+	ext := strings.ToLower(filepath.Ext(fi.Name()))
+	for _, t := range types {
+		switch {
+		case t == "directory":
+			if fi.IsDir() {
+				return true
+			}
+		case t == "file":
+			if !fi.IsDir() {
+				return true
+			}
+		case strings.HasPrefix(t, "."):
+			if !fi.IsDir() && ext == strings.ToLower(t) {
+				return true
+			}
+		default:
+			if fi.IsDir() {
+				continue
+			}
+			for _, e := range fileTypes[t] {
+				if ext == e {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// MatchRule returns the first of the rules matching the entry, or nil
+func MatchRule(rules []*Rule, fi os.FileInfo, now time.Time) *Rule {
+	for _, rule := range rules {
+		if rule.Match(fi, now) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// ParseRules returns the rules of the [[rules]] tables of a configuration
+func ParseRules(tables []configTable) ([]*Rule, error) {
+	parsed := make([]*Rule, 0, len(tables))
+	for i, table := range tables {
+		rule, err := parseRule(table)
+		if err != nil {
+			name := "rule " + strconv.Itoa(i+1)
+			if n, ok := table["name"].(string); ok {
+				name = "rule " + n
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+func parseRule(table configTable) (*Rule, error) {
+	rule := &Rule{Action: RuleMove}
+	for key, value := range table {
+		str, err := configString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		switch key {
+		case "name":
+			rule.Name = str
+		case "glob":
+			if _, err = filepath.Match(str, ""); err != nil {
+				return nil, &GroupbyError{Code: CodeInvalidPattern, Message: "Invalid glob '" + str + "'", Err: err}
+			}
+			rule.Glob = str
+		case "regex":
+			if rule.Regex, err = regexp.Compile(str); err != nil {
+				return nil, &GroupbyError{Code: CodeInvalidPattern, Message: "Invalid regular expression '" + str + "'", Err: err}
+			}
+		case "type":
+			for _, t := range strings.Split(str, ",") {
+				t = strings.ToLower(strings.TrimSpace(t))
+				if _, ok := fileTypes[t]; !ok && t != "file" && t != "directory" && !strings.HasPrefix(t, ".") {
+					return nil, groupbyError("Unknown type '" + t + "'")
+				}
+				rule.Types = append(rule.Types, t)
+			}
+		case "min-size":
+			rule.MinSize, err = ParseSize(str)
+		case "max-size":
+			rule.MaxSize, err = ParseSize(str)
+		case "older-than":
+			rule.MinAge, err = ParseAge(str)
+		case "newer-than":
+			rule.MaxAge, err = ParseAge(str)
+		case "output":
+			rule.Output = expandHome(str)
+		case "layout":
+			var ok bool
+			if rule.Depth, ok = ruleLayouts[str]; !ok {
+				return nil, groupbyError("Unknown layout '" + str + "', expected year, month or day")
+			}
+		case "action":
+			if str != RuleMove && str != RuleCopy && str != RuleSkip {
+				return nil, groupbyError("Unknown action '" + str + "', expected move, copy or skip")
+			}
+			rule.Action = str
+		default:
+			return nil, groupbyError("Unknown rule option '" + key + "'")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return rule, nil
+}
+
+// ParseSize parses a size in bytes with an optional K, M, G or T suffix,
+// e.g. 500K or 1.5GB. Suffixes are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	str := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	multiplier := int64(1)
+	if i := strings.IndexAny(str, "KMGT"); i >= 0 && i == len(str)-1 {
+		multiplier = int64(1) << (10 * (strings.IndexByte("KMGT", str[i]) + 1))
+		str = str[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || n < 0 {
+		return 0, groupbyError("Invalid size '" + s + "'")
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// ParseAge parses a duration like time.ParseDuration, also accepting a
+// number of days or weeks such as 30d or 2w
+func ParseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(s, suffix)); strings.HasSuffix(s, suffix) && err == nil && n >= 0 {
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, groupbyError("Invalid age '" + s + "'")
+	}
+	return d, nil
+}
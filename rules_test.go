@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRules = `
+[[rules]]
+name = "photos"
+type = "image"
+max-size = "1M"
+output = "/srv/Pictures"
+layout = "month"
+
+[[rules]]
+glob = "*.pdf"
+older-than = "30d"
+layout = "year"
+action = "copy"
+
+[[rules]]
+type = ["installer", "directory"]
+action = "skip"
+`
+
+func TestRuleMatch(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, _ := config["rules"].([]configTable)
+	parsed, err := ParseRules(tables)
+	if err != nil {
+		t.Fatalf("ParseRules returned an error: %s", err)
+	}
+
+	now := time.Now()
+	old := now.Add(-60 * 24 * time.Hour)
+	tests := []struct {
+		file     fileInfo
+		expected *Rule
+	}{
+		{fileInfo{"IMG_001.JPG", 2048, 0644, now}, parsed[0]},
+		{fileInfo{"huge.png", 5 << 20, 0644, now}, nil},
+		{fileInfo{"invoice.pdf", 100, 0644, old}, parsed[1]},
+		{fileInfo{"invoice.pdf", 100, 0644, now}, nil},
+		{fileInfo{"setup.exe", 100, 0644, now}, parsed[2]},
+		{fileInfo{"photos", 4096, os.ModeDir, now}, parsed[2]},
+		{fileInfo{"notes.txt", 100, 0644, now}, nil},
+	}
+
+	for _, test := range tests {
+		if got := MatchRule(parsed, test.file, now); got != test.expected {
+			t.Errorf("MatchRule(%s) is incorrect. Got '%v', Expected '%v'", test.file.name, got, test.expected)
+		}
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []configTable{
+		{"type": "spreadsheet"},
+		{"regex": "("},
+		{"glob": "["},
+		{"min-size": "big"},
+		{"older-than": "a while"},
+		{"layout": "week"},
+		{"action": "delete"},
+		{"colour": "blue"},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseRules([]configTable{test}); err == nil {
+			t.Errorf("ParseRules(%v) should fail", test)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+	}{
+		{"100", 100},
+		{"500K", 500 << 10},
+		{"10MB", 10 << 20},
+		{"1.5g", 3 << 29},
+	}
+
+	for _, test := range tests {
+		if got, err := ParseSize(test.size); err != nil || got != test.expected {
+			t.Errorf("ParseSize(%s) is incorrect. Got '%d' (%v), Expected '%d'", test.size, got, err, test.expected)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age      string
+		expected time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"36h", 36 * time.Hour},
+	}
+
+	for _, test := range tests {
+		if got, err := ParseAge(test.age); err != nil || got != test.expected {
+			t.Errorf("ParseAge(%s) is incorrect. Got '%s' (%v), Expected '%s'", test.age, got, err, test.expected)
+		}
+	}
+}
+
+func TestTreeRoute(t *testing.T) {
+	now := time.Now()
+	photos := &Rule{Glob: "*.jpg", Depth: 2, Action: RuleMove}
+	installers := &Rule{Glob: "*.exe", Action: RuleSkip}
+	tree := &Tree{Root: NewNode("/", now.Year(), now.Month(), now.Day()), MaxDepth: 3}
+
+	entries := []os.FileInfo{
+		fileInfo{"a.jpg", 1, 0644, now},
+		fileInfo{"b.jpg", 1, 0644, now},
+		fileInfo{"setup.exe", 1, 0644, now},
+		fileInfo{"notes.txt", 1, 0644, now},
+	}
+	unmatched := tree.route(entries, []*Rule{installers, photos})
+
+	if len(unmatched) != 1 || unmatched[0].Name() != "notes.txt" {
+		t.Errorf("route returned the wrong unmatched entries. Got %d entries, Expected notes.txt", len(unmatched))
+	}
+	if len(tree.Routes) != 1 || tree.Routes[0].Rule != photos {
+		t.Fatalf("route created the wrong routes. Got %d routes, Expected 1", len(tree.Routes))
+	}
+	route := tree.Routes[0].Tree
+	if route.MaxDepth != 2 || route.Files() != 2 {
+		t.Errorf("Route tree is incorrect. Got depth %d with %d files, Expected depth 2 with 2 files", route.MaxDepth, route.Files())
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// photoSidecars are the extensions of the files grouped with the file of the
+// same name by the photos preset: RAW files go with the JPEG or HEIC taken
+// with them, and metadata sidecars with the photo or RAW file they describe
+const photoSidecars = "dng,cr2,cr3,nef,arw,raf,orf,rw2,xmp,aae,thm"
+
+// ParseSidecarExtensions returns the lowercase extensions of a comma
+// separated list such as -sidecars, without their dots
+func ParseSidecarExtensions(list string) []string {
+	var exts []string
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// sidecarPrecedence returns 0 for the files whose extension isn't one of the
+// sidecar extensions, which are primary files, and the position of their
+// extension in exts counting from 1 otherwise. Files go with a file of a
+// lower precedence.
+func sidecarPrecedence(name string, exts []string) int {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	for i, e := range exts {
+		if ext == e {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// FindSidecars returns the companions of the regular files, by the name of
+// the file they go with. A file with one of the sidecar extensions goes with
+// the file named like it without its extension, e.g. IMG_0042.jpg.json with
+// IMG_0042.jpg, or else with the file of the lowest precedence with the same
+// name and another extension, e.g. IMG_0042.xmp with IMG_0042.jpg rather than
+// IMG_0042.cr2.
+func FindSidecars(files []os.FileInfo, exts []string) map[string][]os.FileInfo {
+	if len(exts) == 0 {
+		return nil
+	}
+	byName := map[string]os.FileInfo{}
+	byStem := map[string][]os.FileInfo{}
+	for _, f := range files {
+		if !f.Mode().IsRegular() || strings.HasPrefix(f.Name(), ".") && !includeHidden {
+			continue
+		}
+		byName[f.Name()] = f
+		stem := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+		byStem[stem] = append(byStem[stem], f)
+	}
+
+	primaryOf := map[string]string{}
+	for name := range byName {
+		precedence := sidecarPrecedence(name, exts)
+		if precedence == 0 {
+			continue
+		}
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		if f, ok := byName[stem]; ok && sidecarPrecedence(f.Name(), exts) < precedence {
+			primaryOf[name] = stem
+			continue
+		}
+		best := ""
+		for _, f := range byStem[stem] {
+			p := sidecarPrecedence(f.Name(), exts)
+			if p >= precedence {
+				continue
+			}
+			if best == "" || p < sidecarPrecedence(best, exts) || p == sidecarPrecedence(best, exts) && f.Name() < best {
+				best = f.Name()
+			}
+		}
+		if best != "" {
+			primaryOf[name] = best
+		}
+	}
+
+	companions := map[string][]os.FileInfo{}
+	for name, primary := range primaryOf {
+		// The file gone with may go with another one itself, such as
+		// IMG_0042.cr2.xmp with IMG_0042.cr2 with IMG_0042.jpg. Precedences
+		// only decrease along the way, so it ends.
+		for next, ok := primaryOf[primary]; ok; next, ok = primaryOf[primary] {
+			primary = next
+		}
+		companions[primary] = append(companions[primary], byName[name])
+	}
+	for _, files := range companions {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Name() < files[j].Name()
+		})
+	}
+	return companions
+}
+
+// companionName returns the name of the companion of a primary file named
+// primary once the primary is renamed to renamed, e.g. "IMG_0042 (1).xmp"
+// for IMG_0042.xmp when IMG_0042.jpg is renamed to "IMG_0042 (1).jpg"
+func companionName(companion, primary, renamed string) string {
+	stem := strings.TrimSuffix(primary, filepath.Ext(primary))
+	return strings.TrimSuffix(renamed, filepath.Ext(renamed)) + strings.TrimPrefix(companion, stem)
+}
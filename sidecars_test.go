@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseSidecarExtensions(t *testing.T) {
+	expected := []string{"xmp", "cr2", "json"}
+	if got := ParseSidecarExtensions(".XMP, cr2,,json"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("ParseSidecarExtensions is incorrect. Got %v, Expected %v", got, expected)
+	}
+}
+
+func TestFindSidecars(t *testing.T) {
+	now := time.Now()
+	var files []os.FileInfo
+	for _, name := range []string{
+		"IMG_1.jpg", "IMG_1.CR2", "IMG_1.xmp", "IMG_1.jpg.json", "IMG_1.CR2.xmp",
+		"IMG_2.cr2", "IMG_2.xmp",
+		"IMG_3.xmp", "notes.json", ".hidden.jpg", ".hidden.xmp",
+	} {
+		files = append(files, fileInfo{name, 1, 0644, now})
+	}
+	files = append(files, fileInfo{"IMG_4", 1, os.ModeDir, now}, fileInfo{"IMG_4.xmp", 1, 0644, now})
+
+	got := map[string][]string{}
+	for name, sidecars := range FindSidecars(files, ParseSidecarExtensions(photoSidecars+",json")) {
+		for _, f := range sidecars {
+			got[name] = append(got[name], f.Name())
+		}
+	}
+	expected := map[string][]string{
+		"IMG_1.jpg": {"IMG_1.CR2", "IMG_1.CR2.xmp", "IMG_1.jpg.json", "IMG_1.xmp"},
+		"IMG_2.cr2": {"IMG_2.xmp"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("FindSidecars is incorrect. Got %v, Expected %v", got, expected)
+	}
+
+	if got := FindSidecars(files, nil); len(got) != 0 {
+		t.Errorf("FindSidecars without extensions is incorrect. Got %v, Expected none", got)
+	}
+}
+
+func TestCompanionName(t *testing.T) {
+	tests := []struct {
+		companion string
+		renamed   string
+		expected  string
+	}{
+		{"IMG_1.xmp", "IMG_1.jpg", "IMG_1.xmp"},
+		{"IMG_1.xmp", "IMG_1 (1).jpg", "IMG_1 (1).xmp"},
+		{"IMG_1.jpg.json", "IMG_1 (2).jpg", "IMG_1 (2).jpg.json"},
+	}
+
+	for _, test := range tests {
+		if got := companionName(test.companion, "IMG_1.jpg", test.renamed); got != test.expected {
+			t.Errorf("companionName(%s, %s) is incorrect. Got '%s', Expected '%s'", test.companion, test.renamed, got, test.expected)
+		}
+	}
+}
+
+func TestSidecarUnits(t *testing.T) {
+	defer func(d, o, p, s string) { directory, outputDirectory, conflictPolicy, sidecarExtensions = d, o, p, s }(directory, outputDirectory, conflictPolicy, sidecarExtensions)
+
+	tests := []struct {
+		policy   string
+		expected []string
+	}{
+		{ConflictSkip, []string{"skip 2019/IMG_1.jpg", "skip 2019/IMG_1.xmp"}},
+		{ConflictRename, []string{"move 2019/IMG_1 (1).jpg", "move 2019/IMG_1 (1).xmp"}},
+		{ConflictOverwrite, []string{"move 2019/IMG_1.jpg", "move 2019/IMG_1.xmp"}},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		// The sidecar was written just after midnight, its file just before
+		for name, date := range map[string]time.Time{
+			"IMG_1.jpg": time.Date(2019, 12, 31, 23, 59, 59, 0, time.Local),
+			"IMG_1.xmp": time.Date(2020, 1, 1, 0, 0, 1, 0, time.Local),
+		} {
+			os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+			os.Chtimes(filepath.Join(dir, name), date, date)
+		}
+		// Only the destination of the sidecar is taken
+		os.Mkdir(filepath.Join(dir, "2019"), 0755)
+		os.WriteFile(filepath.Join(dir, "2019", "IMG_1.xmp"), nil, 0644)
+
+		directory, outputDirectory, conflictPolicy, sidecarExtensions = dir, dir, test.policy, photoSidecars
+		tree, err := NewTree(dir, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.SkipGrouped(dir)
+		if err := tree.Build(); err != nil {
+			t.Fatal(err)
+		}
+		if tree.Files() != 2 {
+			t.Errorf("Tree's Files() with a sidecar is incorrect. Got '%d', Expected '%d'", tree.Files(), 2)
+		}
+
+		var got []string
+		for _, op := range planOperations(tree) {
+			dest, _ := filepath.Rel(dir, op.Destination)
+			got = append(got, op.Action+" "+filepath.ToSlash(dest))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Operations with -on-conflict %s are incorrect. Got %v, Expected %v", test.policy, got, test.expected)
+		}
+	}
+}
+
+func TestSidecarFilter(t *testing.T) {
+	defer func(d, o, p, s string) { directory, outputDirectory, filterPattern, sidecarExtensions = d, o, p, s }(directory, outputDirectory, filterPattern, sidecarExtensions)
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		// Companions go with their file whether they match or not
+		{`\.pdf$`, []string{"report.json", "report.pdf"}},
+		// and are grouped on their own when their file doesn't match
+		{`\.json$`, []string{"other.json", "report.json"}},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		for _, name := range []string{"report.pdf", "report.json", "other.json"} {
+			os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+		}
+		directory, outputDirectory, filterPattern, sidecarExtensions = dir, dir, test.pattern, "json"
+		tree, err := NewTree(dir, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Build(); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, op := range planOperations(tree) {
+			got = append(got, filepath.Base(op.Source))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Files grouped with -e %s are incorrect. Got %v, Expected %v", test.pattern, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// folderStats is the number and total size of the files grouped into a folder
+type folderStats struct {
+	Files       int
+	Directories int
+	Bytes       int64
+}
+
+// StatsVisitor counts the files and bytes that would be grouped into each
+// folder, without touching any files
+type StatsVisitor struct {
+	NodeVisitor
+	destinations *destinationBuilder
+	outputDir    string
+	Folders      map[string]*folderStats
+}
+
+func NewStatsVisitor(root, output string, flatten bool) *StatsVisitor {
+	return &StatsVisitor{
+		destinations: newDestinationBuilder(root, output, flatten),
+		outputDir:    output,
+		Folders:      map[string]*folderStats{},
+	}
+}
+
+func (s *StatsVisitor) Visit(n *Node, depth int) {
+	for _, op := range s.destinations.Operations(n, depth) {
+		if op.Action != ActionSkip {
+			s.add(op)
+		}
+	}
+}
+
+// add counts the file or directory of the operation in the folder it is
+// grouped into
+func (s *StatsVisitor) add(op *Operation) {
+	// Folders are shown relative to the output directory, unless a rule
+	// groups them elsewhere
+	folder := filepath.Dir(op.Destination)
+	if output, err := filepath.Abs(s.outputDir); err == nil {
+		if dir, err := filepath.Abs(folder); err == nil {
+			if rel, err := filepath.Rel(output, dir); err == nil && !strings.HasPrefix(rel, "..") {
+				folder = filepath.ToSlash(rel)
+			}
+		}
+	}
+	stats, ok := s.Folders[folder]
+	if !ok {
+		stats = &folderStats{}
+		s.Folders[folder] = stats
+	}
+	stat, err := os.Lstat(op.Source)
+	if err != nil {
+		return
+	}
+	if stat.IsDir() {
+		stats.Directories++
+		return
+	}
+	stats.Files++
+	stats.Bytes += stat.Size()
+}
+
+// Write writes a table of the folders in name order followed by the totals
+func (s *StatsVisitor) Write(w io.Writer) {
+	folders := make([]string, 0, len(s.Folders))
+	for folder := range s.Folders {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+
+	total := folderStats{}
+	for _, folder := range folders {
+		stats := s.Folders[folder]
+		fmt.Fprintf(w, "%-32s %6d files %6d directories %10s\n", folder, stats.Files, stats.Directories, formatBytes(stats.Bytes))
+		total.Files += stats.Files
+		total.Directories += stats.Directories
+		total.Bytes += stats.Bytes
+	}
+	fmt.Fprintf(w, "\n%d folders, %d files, %d directories, %s\n", len(folders), total.Files, total.Directories, formatBytes(total.Bytes))
+}
+
+// formatBytes returns a human readable size such as 1.5 MB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
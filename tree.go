@@ -6,81 +6,221 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
 type Tree struct {
-	Root           *Node
-	MaxDepth       int
+	Root     *Node
+	MaxDepth int
+	// Routes are the trees of the entries routed to rules
+	Routes []*Route
+	// grouped are the folders groupby grouped files into, which are left
+	// alone. Nil unless SkipGrouped was called.
+	grouped map[string]bool
+	// Duplicates are the files with the same content as another file of
+	// the directory, found with -duplicates
+	Duplicates []*Duplicate
+	// duplicateOf maps the names of the duplicates to their original
+	duplicateOf map[string]string
+	// sidecars maps the names of files to their companions, see -sidecars
+	sidecars       map[string][]os.FileInfo
 	directoryCount int
 	fileCount      int
 }
 
-func NewTree(directory string, maxDepth int) *Tree {
-	year, month, day := GetYMD(directory)
+// NewTree returns the tree of the directory, or an error if the directory
+// can't be read
+func NewTree(directory string, maxDepth int) (*Tree, error) {
+	year, month, day, err := GetYMD(directory)
+	if err != nil {
+		return nil, err
+	}
 	dirPath, err := filepath.Abs(directory)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	return &Tree{
 		Root:           NewNode(dirPath, year, month, day),
 		MaxDepth:       maxDepth,
 		directoryCount: 0,
 		fileCount:      0,
-	}
+	}, nil
 }
 
 func (t *Tree) Build() error {
 	file, err := os.Open(t.Root.FileName)
 
 	if err != nil {
-		return err
-	}
-
-	var regularExpression *regexp.Regexp
-	if filterPattern != "" {
-		regularExpression, err = regexp.Compile(filterPattern)
-		if err != nil {
-			return groupbyError("Invalid regular expression specified in -e/-pattern")
-		}
+		return codedError(CodeUnreadableSource, t.Root.FileName, err)
 	}
 
 	files, err := file.Readdir(-1)
 
 	if err != nil {
-		return err
+		return codedError(CodeUnreadableSource, t.Root.FileName, err)
 	}
 
 	if files == nil {
 		return groupbyError("Directory is empty or cannot be read")
 	}
 
+	return t.AddEntries(files)
+}
+
+// AddEntries adds the entries of the tree's directory that aren't filtered
+// out, routing them to the rules and grouping the others by events or date
+func (t *Tree) AddEntries(files []os.FileInfo) error {
+	var regularExpression *regexp.Regexp
+	if filterPattern != "" {
+		var err error
+		regularExpression, err = regexp.Compile(filterPattern)
+		if err != nil {
+			return &GroupbyError{Code: CodeInvalidPattern, Message: "Invalid regular expression specified in -e/-pattern", Err: err}
+		}
+	}
+
+	entries := make([]os.FileInfo, 0, len(files))
 	for _, f := range files {
+		// groupby's own journals are never grouped
+		if f.Name() == stateDirName {
+			continue
+		}
+		if t.isGrouped(f) {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Skipping %s, files were grouped into it\n", f.Name())
+			}
+			continue
+		}
 		if regularExpression != nil && !regularExpression.MatchString(f.Name()) {
 			continue
 		}
 		if ignoreDirectories && f.IsDir() {
 			continue
-		} else {
-			t.AddEntry(f)
 		}
+		entries = append(entries, f)
+	}
+	entries = t.attachSidecars(files, entries)
+
+	if duplicatePolicy != DuplicatesNone {
+		entries = t.separateDuplicates(entries)
+	}
+
+	if len(rules) > 0 {
+		entries = t.route(entries, rules)
+	}
+
+	if len(calendarEvents) > 0 {
+		entries = t.AddCalendarEvents(entries, calendarEvents)
+	}
+
+	if events {
+		t.AddEvents(entries, eventGap)
+		return nil
+	}
+
+	for _, f := range entries {
+		t.AddEntry(f)
 	}
 	return nil
 }
 
-func (t *Tree) AddEntry(file os.FileInfo) {
+// attachSidecars finds the companions of the files and returns the entries
+// without the companions of the entries, which go with them whether they
+// match -e or not. The companions of files left out are entries of their own.
+func (t *Tree) attachSidecars(files, entries []os.FileInfo) []os.FileInfo {
+	included := map[string]bool{}
+	for _, f := range entries {
+		included[f.Name()] = true
+	}
+	companions := map[string]bool{}
+	for name, sidecars := range FindSidecars(files, ParseSidecarExtensions(sidecarExtensions)) {
+		if !included[name] {
+			continue
+		}
+		if t.sidecars == nil {
+			t.sidecars = map[string][]os.FileInfo{}
+		}
+		t.sidecars[name] = sidecars
+		for _, f := range sidecars {
+			companions[f.Name()] = true
+		}
+	}
+	if len(companions) == 0 {
+		return entries
+	}
+
+	primaries := make([]os.FileInfo, 0, len(entries))
+	for _, f := range entries {
+		if !companions[f.Name()] {
+			primaries = append(primaries, f)
+		}
+	}
+	return primaries
+}
 
+// route adds the entries matching a rule to the tree of the rule, returning
+// the entries no rule matched. Entries matching a skip rule are left alone.
+func (t *Tree) route(entries []os.FileInfo, rules []*Rule) []os.FileInfo {
+	routes := map[*Rule]*Route{}
+	unmatched := entries[:0]
+	now := time.Now()
+	for _, f := range entries {
+		rule := MatchRule(rules, f, now)
+		if rule == nil {
+			unmatched = append(unmatched, f)
+			continue
+		}
+		if rule.Action == RuleSkip {
+			continue
+		}
+		route, ok := routes[rule]
+		if !ok {
+			maxDepth := rule.Depth
+			if maxDepth == 0 {
+				maxDepth = t.MaxDepth
+			}
+			route = &Route{Rule: rule, Tree: &Tree{Root: NewNode(t.Root.FileName, t.Root.Year, t.Root.Month, t.Root.Day), MaxDepth: maxDepth, duplicateOf: t.duplicateOf, sidecars: t.sidecars}}
+			routes[rule] = route
+		}
+		route.Tree.AddEntry(f)
+	}
+
+	for _, rule := range rules {
+		if route, ok := routes[rule]; ok {
+			t.Routes = append(t.Routes, route)
+		}
+	}
+	return unmatched
+}
+
+// count reports whether the entry should be added to the tree, counting it
+// as a directory or file if so, along with its companions
+func (t *Tree) count(file os.FileInfo) bool {
 	if strings.HasPrefix(file.Name(), ".") && !includeHidden {
-		return
+		return false
 	}
 
 	if file.IsDir() {
 		t.directoryCount++
 	} else {
-		t.fileCount++
+		t.fileCount += 1 + len(t.sidecars[file.Name()])
 	}
+	return true
+}
 
-	year, month, day := GetFileInfoYMD(file)
-	var node = NewNode(file.Name(), year, month, day)
+func (t *Tree) AddEntry(file os.FileInfo) {
+
+	if !t.count(file) {
+		return
+	}
+
+	t.addNode(t.newFileNode(file))
+}
+
+// addNode adds the node of a file under the year, month and day nodes of its
+// date, down to the tree's depth
+func (t *Tree) addNode(node *Node) {
+	year, month, day := node.Year, node.Month, node.Day
 
 	yearStr, monthStr, dayStr := fmt.Sprintf("%d", year), fmt.Sprintf("%d", month), fmt.Sprintf("%d", day)
 	var yearNode = t.Root.Search(yearStr)
@@ -120,6 +260,25 @@ func (t *Tree) AddEntry(file os.FileInfo) {
 	}
 }
 
+// newFileNode returns the node for an entry in the tree's directory, dated
+// according to -date-source, with the nodes of its companions
+func (t *Tree) newFileNode(file os.FileInfo) *Node {
+	tm, source := FileDate(filepath.Join(t.Root.FileName, file.Name()), file)
+	year, month, day := BucketYMD(tm)
+	node := NewNode(file.Name(), year, month, day)
+	node.Date = tm
+	node.DateSource = source
+	node.DuplicateOf = t.duplicateOf[file.Name()]
+	// Companions are grouped by the date of the file they go with
+	for _, sidecar := range t.sidecars[file.Name()] {
+		companion := NewNode(sidecar.Name(), year, month, day)
+		companion.Date = tm
+		companion.DateSource = source
+		node.Companions = append(node.Companions, companion)
+	}
+	return node
+}
+
 func (t *Tree) Visit(visitor NodeVisitor) {
 	t.Root.Visit(visitor, 0)
 }
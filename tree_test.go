@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -70,3 +71,9 @@ func TestAddEntryIncrementsDirectoryAndFileCounts(t *testing.T) {
 		t.Errorf("Tree's Files() is incorrect. Got '%d', Expected '%d'", tree.Files(), 4)
 	}
 }
+
+func TestNewTreeMissingDirectory(t *testing.T) {
+	if _, err := NewTree(filepath.Join(t.TempDir(), "missing"), 1); err == nil {
+		t.Errorf("NewTree should return an error for a missing directory")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// journalDestinations returns the entries of the journals of outputDir that
+// haven't been undone by the absolute path of their destination, later runs
+// taking precedence
+func journalDestinations(outputDir string) map[string]*JournalEntry {
+	destinations := map[string]*JournalEntry{}
+	// Journal names start with the time they were created at, so Glob
+	// returns them oldest first
+	journals, _ := filepath.Glob(filepath.Join(journalDir(outputDir), "*"+journalExtension))
+	for _, journal := range journals {
+		entries, err := ReadJournal(journal)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			destinations[entry.Destination] = entry
+		}
+	}
+	return destinations
+}
+
+// UngroupOperations returns the operations moving the files and directories
+// in the date folders of dir back into target, and the date folders deepest
+// first. Files recorded in the journals of dir get back the name they had
+// before grouping. Links to files that are still in target are removed
+// instead of moved. Other conflicts are resolved with -on-conflict.
+func UngroupOperations(dir, target string) ([]*Operation, []string, error) {
+	destinations := journalDestinations(dir)
+	builder := newDestinationBuilder(dir, target, false)
+
+	// Files recorded in the journals get their names first
+	var journaled, others []*Operation
+	folders, err := walkGrouped(dir, func(path string, entry os.FileInfo, b bucket) {
+		tm, source := FileDate(path, entry)
+		op := &Operation{
+			Source:      path,
+			Destination: filepath.Join(target, entry.Name()),
+			Date:        tm,
+			DateSource:  source,
+			Action:      ActionMove,
+		}
+		abs, _ := filepath.Abs(path)
+		if recorded, ok := destinations[abs]; ok {
+			op.Destination = filepath.Join(target, filepath.Base(recorded.Source))
+			journaled = append(journaled, op)
+		} else {
+			others = append(others, op)
+		}
+	})
+
+	ops := append(journaled, others...)
+	for _, op := range ops {
+		if isLinkTo(op.Source, op.Destination) {
+			op.Action = ActionUnlink
+			builder.planned[op.Destination] = true
+		} else {
+			builder.resolveConflict(op)
+		}
+	}
+	return ops, folders, err
+}
+
+// isLinkTo returns true if path is a hard link to the file at dest or a
+// symlink to it
+func isLinkTo(path, dest string) bool {
+	destStat, err := os.Lstat(dest)
+	if err != nil {
+		return false
+	}
+	if stat, err := os.Lstat(path); err == nil && os.SameFile(stat, destStat) {
+		return true
+	}
+	if link, err := os.Readlink(path); err == nil {
+		abs, _ := filepath.Abs(dest)
+		return link == abs || link == dest
+	}
+	return false
+}
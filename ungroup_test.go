@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUngroupOperations(t *testing.T) {
+	defer func() { conflictPolicy = ConflictSkip }()
+	conflictPolicy = ConflictRename
+
+	dir := t.TempDir()
+	write := func(name string) string {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	original := write("linked.jpg")
+	write(filepath.Join("2019", "July", "5", "a.jpg"))
+	write(filepath.Join("2019", "July", "20", "photo.jpg"))
+	renamed := write(filepath.Join("2019", "August", "photo (1).jpg"))
+	write(filepath.Join("Photos", "b.jpg"))
+	if err := os.Link(original, filepath.Join(dir, "2019", "August", "linked.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	// photo (1).jpg was renamed when grouping, it gets its name back first
+	journal := NewJournal(dir)
+	journal.Record(&Operation{Source: filepath.Join(dir, "photo.jpg"), Destination: renamed, Action: ActionMove})
+	journal.Close()
+
+	ops, folders, err := UngroupOperations(dir, dir)
+	if err != nil {
+		t.Fatalf("UngroupOperations returned an error: %s", err)
+	}
+
+	expected := map[string]struct {
+		destination string
+		action      string
+	}{
+		"a.jpg":         {filepath.Join(dir, "a.jpg"), ActionMove},
+		"photo.jpg":     {filepath.Join(dir, "photo (1).jpg"), ActionMove},
+		"photo (1).jpg": {filepath.Join(dir, "photo.jpg"), ActionMove},
+		"linked.jpg":    {filepath.Join(dir, "linked.jpg"), ActionUnlink},
+	}
+	if len(ops) != len(expected) {
+		t.Errorf("UngroupOperations returned %d operations, Expected %d", len(ops), len(expected))
+	}
+	for _, op := range ops {
+		want := expected[filepath.Base(op.Source)]
+		if op.Destination != want.destination || op.Action != want.action {
+			t.Errorf("Ungrouping %s is incorrect. Got (%s, %s), Expected (%s, %s)", op.Source, op.Destination, op.Action, want.destination, want.action)
+		}
+	}
+	if len(folders) != 5 || filepath.Base(folders[len(folders)-1]) != "2019" {
+		t.Errorf("UngroupOperations folders are incorrect. Got %v", folders)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// entryState is the size and modification time an entry of a watched
+// directory had when it was last scanned
+type entryState struct {
+	size    int64
+	modTime time.Time
+	// since is when the entry was first seen with this size and
+	// modification time
+	since time.Time
+	// grouped is set once the entry was handed out to be grouped, so
+	// entries that are left in place aren't grouped again
+	grouped bool
+}
+
+// Watcher scans a directory for the entries whose size and modification
+// time stayed unchanged for the settle interval
+type Watcher struct {
+	dir    string
+	settle time.Duration
+	states map[string]*entryState
+	// ignored are the names of entries that are never grouped, such as
+	// the folders files are grouped into
+	ignored map[string]bool
+}
+
+// NewWatcher returns a watcher for dir. Unless existing is set, the entries
+// already in dir are left alone.
+func NewWatcher(dir string, settle time.Duration, existing bool) (*Watcher, error) {
+	w := &Watcher{
+		dir:     dir,
+		settle:  settle,
+		states:  map[string]*entryState{},
+		ignored: map[string]bool{stateDirName: true},
+	}
+	if !existing {
+		entries, err := w.readDir()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			w.ignored[entry.Name()] = true
+		}
+	}
+	return w, nil
+}
+
+func (w *Watcher) readDir() ([]os.FileInfo, error) {
+	file, err := os.Open(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Readdir(-1)
+}
+
+// Scan returns the entries that haven't changed for the settle interval and
+// haven't been returned before, in name order
+func (w *Watcher) Scan(now time.Time) ([]os.FileInfo, error) {
+	entries, err := w.readDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var stable []os.FileInfo
+	present := map[string]bool{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if w.ignored[name] {
+			continue
+		}
+		present[name] = true
+
+		state, ok := w.states[name]
+		if !ok || state.size != entry.Size() || !state.modTime.Equal(entry.ModTime()) {
+			w.states[name] = &entryState{size: entry.Size(), modTime: entry.ModTime(), since: now}
+			continue
+		}
+		if !state.grouped && now.Sub(state.since) >= w.settle {
+			state.grouped = true
+			stable = append(stable, entry)
+		}
+	}
+
+	// Entries that were moved away or deleted are forgotten
+	for name := range w.states {
+		if !present[name] {
+			delete(w.states, name)
+		}
+	}
+	sort.Slice(stable, func(i, j int) bool { return stable[i].Name() < stable[j].Name() })
+	return stable, nil
+}
+
+// Pending returns true if some entries are waiting to settle
+func (w *Watcher) Pending() bool {
+	for _, state := range w.states {
+		if !state.grouped {
+			return true
+		}
+	}
+	return false
+}
+
+// Ignore leaves the entry of the watched directory that path is in alone
+// from now on. Paths outside the directory are ignored.
+func (w *Watcher) Ignore(path string) {
+	dir, err := filepath.Abs(w.dir)
+	if err != nil {
+		return
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return
+	}
+	name := strings.Split(filepath.ToSlash(rel), "/")[0]
+	w.ignored[name] = true
+	delete(w.states, name)
+}
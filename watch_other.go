@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// watchDirectory isn't supported on this platform, the directory is polled
+// instead
+func watchDirectory(dir string) (<-chan struct{}, error) {
+	return nil, groupbyError("Change notifications are not supported on this platform")
+}
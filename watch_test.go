@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherScan(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("existing.txt", "old")
+
+	watcher, err := NewWatcher(dir, time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	write("a.jpg", "a")
+	write("b.jpg", "b")
+
+	tests := []struct {
+		after    time.Duration
+		change   string
+		expected []string
+	}{
+		// Entries are only grouped once they stop changing
+		{0, "", nil},
+		{30 * time.Second, "b.jpg", nil},
+		{time.Minute, "", []string{"a.jpg"}},
+		{2 * time.Minute, "", []string{"b.jpg"}},
+		{3 * time.Minute, "", nil},
+	}
+
+	for _, test := range tests {
+		if test.change != "" {
+			write(test.change, "changed")
+		}
+		entries, err := watcher.Scan(start.Add(test.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		if len(names) != len(test.expected) || (len(names) > 0 && names[0] != test.expected[0]) {
+			t.Errorf("Scan after %s is incorrect. Got %v, Expected %v", test.after, names, test.expected)
+		}
+	}
+	if watcher.Pending() {
+		t.Errorf("Pending() should be false once every entry was grouped")
+	}
+}
+
+func TestWatcherIgnore(t *testing.T) {
+	dir := t.TempDir()
+	watcher, err := NewWatcher(dir, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher.Ignore(filepath.Join(dir, "2019", "July", "a.jpg"))
+	watcher.Ignore(filepath.Join(filepath.Dir(dir), "elsewhere", "b.jpg"))
+
+	if !watcher.ignored["2019"] {
+		t.Errorf("Ignore should ignore the folder a file was grouped into")
+	}
+	if len(watcher.ignored) != 2 {
+		t.Errorf("Ignore should only ignore entries of the watched directory. Got %v", watcher.ignored)
+	}
+}